@@ -1,11 +1,17 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/nurashi/Newton/internal/ai"
 	"github.com/nurashi/Newton/internal/config"
 	"github.com/nurashi/Newton/internal/database"
+	"github.com/nurashi/Newton/internal/logger"
+	"github.com/nurashi/Newton/internal/metrics"
 	"github.com/nurashi/Newton/internal/repository"
 	"github.com/nurashi/Newton/internal/telegram"
 	"github.com/nurashi/Newton/migrations"
@@ -14,30 +20,92 @@ import (
 func main() {
 	cfg := config.Load("config")
 	if cfg == nil {
-		log.Fatal("FATAL: failed to load config")
+		logger.Fatal("failed to load config")
 	}
 
+	logger.Setup(cfg.Log.Level, cfg.Log.Env, cfg.Secrets()...)
 	cfg.Validate()
-	log.Printf("CONFIG: %+v", cfg)
+	slog.Info("config loaded",
+		"ai_provider", cfg.AI.Provider,
+		"embeddings_provider", cfg.Embeddings.Provider,
+		"telegram_mode", cfg.Telegram.Mode,
+		"workers", cfg.Telegram.Workers,
+		"db_host", cfg.Database.Host,
+		"db_name", cfg.Database.Name)
 
 	dbpool, err := database.NewPostgresPool(cfg.Database)
 	if err != nil {
-		log.Fatalf("FATAL: failed to create new Pool: %v", err)
+		logger.Fatal("failed to create postgres pool", "error", err)
 	}
 	defer dbpool.Close()
 
-	log.Println("SUCCESSFULLY CONNECTED TO POSTGRES")
+	slog.Info("connected to postgres")
 
 	if err := migrations.RunMigrations(dbpool); err != nil {
-		log.Printf("WARNING: failed to run mig: %v", err)
+		slog.Warn("failed to run migrations", "error", err)
 	}
 
 	userService := repository.NewUserRepository(dbpool)
+	convService := repository.NewConversationRepository(dbpool)
+	docService := repository.NewDocumentRepository(dbpool)
+	usageService := repository.NewUsageRepository(dbpool)
+	broadcastService := repository.NewBroadcastRepository(dbpool)
+	errorService := repository.NewErrorRepository(dbpool)
+	chatSettingsService := repository.NewChatSettingsRepository(dbpool)
+	inlineService := repository.NewInlineRepository(dbpool)
 
 	botToken := os.Getenv("TELEGRAM_BOT_TOKEN")
 	if botToken == "" {
-		log.Fatal("FATAL: TELEGRAM_BOT_TOKEN not set in .env or environment")
+		logger.Fatal("TELEGRAM_BOT_TOKEN not set in .env or environment")
 	}
 
-	telegram.RunTelegramBot(userService)
+	provider, err := ai.NewProvider(cfg)
+	if err != nil {
+		logger.Fatal("failed to create AI provider", "error", err)
+	}
+	slog.Info("AI provider ready", "provider", provider.Name(), "model", provider.Model())
+
+	embedder, err := ai.NewEmbedder(cfg)
+	if err != nil {
+		logger.Fatal("failed to create embedder", "error", err)
+	}
+
+	transcriber, err := ai.NewTranscriber(cfg)
+	if err != nil {
+		logger.Fatal("failed to create transcriber", "error", err)
+	}
+	speaker, err := ai.NewSpeaker(cfg)
+	if err != nil {
+		logger.Fatal("failed to create speaker", "error", err)
+	}
+	slog.Info("speech ready", "transcription", cfg.Speech.Transcription.Provider, "tts", cfg.Speech.TTS.Provider)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if cfg.Metrics.Port != 0 {
+		metrics.RegisterPool(dbpool)
+		metrics.Serve(ctx, cfg.Metrics.Port)
+	}
+
+	err = telegram.RunTelegramBot(ctx, cfg.Telegram, telegram.Deps{
+		Users:         userService,
+		Conversations: convService,
+		Documents:     docService,
+		Usage:         usageService,
+		Broadcasts:    broadcastService,
+		Errors:        errorService,
+		ChatSettings:  chatSettingsService,
+		Inline:        inlineService,
+		Provider:      provider,
+		Embedder:      embedder,
+		Transcriber:   transcriber,
+		Speaker:       speaker,
+		Limits:        cfg.Limits,
+	})
+	if err != nil {
+		logger.Fatal("bot stopped with error", "error", err)
+	}
+
+	slog.Info("bot stopped")
 }
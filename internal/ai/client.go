@@ -2,199 +2,222 @@ package ai
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
-	"net/http"
-	"os"
 	"strings"
+
+	"github.com/nurashi/Newton/internal/config"
 )
 
 type Message struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// Images are sent along with Content, only user messages carry them
+	Images []Image `json:"-"`
 }
 
-// Request Body, Model -> model of AI like GPT-3.5 etc.
-type RequestBody struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
+// Image is a picture attached to a message
+type Image struct {
+	MimeType string
+	Data     []byte
 }
 
-type ResponseBody struct {
-	Choices []struct {
-		Message struct {
-			Content string `json:"content"`
-		} `json:"message"`
-	} `json:"choices"`
-	Error struct {
-		Message string `json:"message"`
-	} `json:"error"`
+// contentPart is an element of an OpenAI multimodal message content
+type contentPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *imageURL `json:"image_url,omitempty"`
 }
 
+type imageURL struct {
+	URL string `json:"url"`
+}
+
+// MarshalJSON sends messages with images as OpenAI content parts, images are inlined as data URLs
+func (m Message) MarshalJSON() ([]byte, error) {
+	type plain Message
+	if len(m.Images) == 0 {
+		return json.Marshal(plain(m))
+	}
+
+	parts := []contentPart{{Type: "text", Text: m.Content}}
+	for _, img := range m.Images {
+		url := "data:" + img.MimeType + ";base64," + base64.StdEncoding.EncodeToString(img.Data)
+		parts = append(parts, contentPart{Type: "image_url", ImageURL: &imageURL{URL: url}})
+	}
+
+	return json.Marshal(struct {
+		Role    string        `json:"role"`
+		Content []contentPart `json:"content"`
+	}{m.Role, parts})
+}
+
+// ChatRequest is the body of an OpenAI-compatible /chat/completions call, Model -> model of AI like GPT-3.5 etc.
 type ChatRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
+	Model         string         `json:"model"`
+	Messages      []Message      `json:"messages"`
+	Stream        bool           `json:"stream,omitempty"`
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type Choice struct {
 	Message Message `json:"message"`
+	Delta   Message `json:"delta"`
 }
 
 type ChatResponse struct {
 	Choices []Choice `json:"choices"`
+	Usage   struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
 }
 
+// OpenAIProvider talks to any OpenAI-compatible chat completions API (OpenRouter, LM Studio, ...)
+type OpenAIProvider struct {
+	name    string
+	baseURL string
+	model   string
+	headers map[string]string
+}
 
-func Ask(prompt string) (string, error) {
-	apiKey := os.Getenv("OPENROUTER_API_KEY")
-	body := RequestBody{
-		Model: "mistralai/mistral-7b-instruct:free",
-		Messages: []Message{
-			{Role: "user", Content: prompt},
+func NewOpenRouterProvider(cfg config.OpenRouter) *OpenAIProvider {
+	return &OpenAIProvider{
+		name:    "openrouter",
+		baseURL: "https://openrouter.ai/api/v1",
+		model:   cfg.Model,
+		headers: map[string]string{
+			"Authorization": "Bearer " + cfg.APIKey,
+			"HTTP-Referer":  cfg.Referer,
+			"X-Title":       "Newton",
 		},
 	}
+}
 
-	data, err := json.Marshal(body)
-	if err != nil {
-		log.Printf("ERROR with convertion to json: %v", err)
-	}
-
-	req, err := http.NewRequestWithContext(context.Background(), "POST", "https://openrouter.ai/api/v1/chat/completions", strings.NewReader(string(data)))
-
-	if err != nil {
-		log.Printf("ERROR with request with context: %v", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("HTTP-Referer", "https://github.com/nurashi/OpenRouterProject")
-	req.Header.Set("X-Title", "DevPrompt")
-
-	resp, err := http.DefaultClient.Do(req)
-
-	if err != nil {
-		return "", err
-	}
-
-	defer resp.Body.Close()
-
-	raw, err := io.ReadAll(resp.Body)
-
-	if err != nil {
-		log.Printf("ERROR: %v", err)
-	}
-
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("API error: %s", string(raw))
+func NewLMStudioProvider(cfg config.LMStudio) *OpenAIProvider {
+	return &OpenAIProvider{
+		name:    "lmstudio",
+		baseURL: strings.TrimSuffix(cfg.URL, "/"),
+		model:   cfg.Model,
 	}
+}
 
-	var parsed ResponseBody
-
-	_ = json.Unmarshal(raw, &parsed)
+func (o *OpenAIProvider) Name() string  { return o.name }
+func (o *OpenAIProvider) Model() string { return o.model }
 
-	if len(parsed.Choices) == 0 {
-		return "AI response is empty", nil
-	}
-
-	return parsed.Choices[0].Message.Content, nil
+func (o *OpenAIProvider) Ask(ctx context.Context, prompt string) (*Response, error) {
+	return o.Chat(ctx, []Message{{Role: RoleUser, Content: prompt}})
 }
 
-func AskWithHistory(history []Message) (string, error) {
-	apiKey := os.Getenv("OPENROUTER_API_KEY")
-
-	body := RequestBody{
-		Model:    "mistralai/mistral-7b-instruct:free",
+func (o *OpenAIProvider) Chat(ctx context.Context, history []Message) (*Response, error) {
+	reqBody := ChatRequest{
+		Model:    o.model,
 		Messages: history,
 	}
 
-	data, _ := json.Marshal(body)
-
-	req, _ := http.NewRequestWithContext(context.Background(),
-		"POST",
-		"https://openrouter.ai/api/v1/chat/completions",
-		strings.NewReader(string(data)),
-	)
-
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("HTTP-Referer", "https://github.com/nurashi/OpenRouterProject")
-	req.Header.Set("X-Title", "DevPrompt")
+	var result *Response
+	err := retryWithBackoff(ctx, 4, func() error {
+		body, err := postJSON(ctx, o.baseURL+"/chat/completions", o.headers, reqBody)
+		if err != nil {
+			return err
+		}
+
+		var parsed ChatResponse
+		if err := json.Unmarshal(body, &parsed); err != nil {
+			return fmt.Errorf("failed to unmarshal response: %w", err)
+		}
+
+		if parsed.Error.Message != "" {
+			return fmt.Errorf("API error: %s", parsed.Error.Message)
+		}
+
+		result = &Response{
+			Text: "AI response is empty",
+			Usage: Usage{
+				PromptTokens:     parsed.Usage.PromptTokens,
+				CompletionTokens: parsed.Usage.CompletionTokens,
+				TotalTokens:      parsed.Usage.TotalTokens,
+			},
+		}
+		if len(parsed.Choices) > 0 {
+			result.Text = parsed.Choices[0].Message.Content
+		}
+		return nil
+	})
 
-	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	raw, _ := io.ReadAll(resp.Body)
-
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("API ERROR: %s", string(raw))
-	}
-
-	var parsed ResponseBody
-	_ = json.Unmarshal(raw, &parsed)
-
-	if len(parsed.Choices) == 0 {
-		return "AI response is empty", nil
-	}
-
-	return parsed.Choices[0].Message.Content, nil
+	return result, nil
 }
 
-func LMStudioAPICall(prompt string) (string, error) {
-	baseURL := "http://192.168.1.81:1234/v1/chat/completions"
-	model := "google/gemma-3-4b"
-
-	body := RequestBody{
-		Model: model,
-		Messages: []Message{
-			{Role: "user", Content: prompt},
-		},
-	}
-
-	data, err := json.Marshal(body)
+// ChatStream requests a streamed completion and reads the SSE deltas
+func (o *OpenAIProvider) ChatStream(ctx context.Context, history []Message, onDelta func(delta string)) (*Response, error) {
+	reqBody := ChatRequest{
+		Model:         o.model,
+		Messages:      history,
+		Stream:        true,
+		StreamOptions: &StreamOptions{IncludeUsage: true},
+	}
+
+	// only opening the stream is retried, a broken stream would repeat already delivered text
+	var body io.ReadCloser
+	err := retryWithBackoff(ctx, 4, func() error {
+		var err error
+		body, err = openStream(ctx, o.baseURL+"/chat/completions", o.headers, reqBody)
+		return err
+	})
 	if err != nil {
-		log.Printf("ERROR with conversion to json: %v", err)
-		return "", err
-	}
-
-	req, err := http.NewRequestWithContext(context.Background(), "POST", baseURL, strings.NewReader(string(data)))
+		return nil, err
+	}
+	defer body.Close()
+
+	var text strings.Builder
+	result := &Response{}
+
+	err = readSSE(body, func(data []byte) error {
+		var chunk ChatResponse
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return fmt.Errorf("failed to unmarshal stream chunk: %w", err)
+		}
+
+		if chunk.Error.Message != "" {
+			return fmt.Errorf("API error: %s", chunk.Error.Message)
+		}
+
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			text.WriteString(chunk.Choices[0].Delta.Content)
+			onDelta(chunk.Choices[0].Delta.Content)
+		}
+
+		if chunk.Usage.TotalTokens > 0 {
+			result.Usage = Usage{
+				PromptTokens:     chunk.Usage.PromptTokens,
+				CompletionTokens: chunk.Usage.CompletionTokens,
+				TotalTokens:      chunk.Usage.TotalTokens,
+			}
+		}
+		return nil
+	})
+
+	result.Text = text.String()
 	if err != nil {
-		log.Printf("ERROR with request with context: %v", err)
-		return "", err
+		return result, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	raw, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("ERROR: %v", err)
-		return "", err
+	if result.Text == "" {
+		result.Text = "AI response is empty"
 	}
-
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("API error: %s", string(raw))
-	}
-
-	var parsed ResponseBody
-	err = json.Unmarshal(raw, &parsed)
-	if err != nil {
-		log.Printf("ERROR parsing response: %v", err)
-		return "", err
-	}
-
-	if len(parsed.Choices) == 0 {
-		return "AI response is empty", nil
-	}
-	return parsed.Choices[0].Message.Content, nil
+	return result, nil
 }
-
@@ -1,10 +1,11 @@
 package ai
 
 import (
+	"context"
 	"fmt"
 )
 
-func GeneratePitch(idea string) (string, error) {
+func GeneratePitch(ctx context.Context, p Provider, idea string) (string, error) {
 	if idea == "" {
 		return "", fmt.Errorf("no idea provided")
 	}
@@ -17,5 +18,10 @@ Include:
 4. Target audience
 5. Business model`, idea)
 
-	return AskGemini(prompt)
+	resp, err := p.Ask(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.Text, nil
 }
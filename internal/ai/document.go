@@ -0,0 +1,33 @@
+package ai
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Passage is an excerpt of a document and where it was taken from, e.g. "page 3"
+type Passage struct {
+	Location string
+	Text     string
+}
+
+// DocumentPrompt is the system instruction that grounds answers in excerpts of an uploaded document
+func DocumentPrompt(filename string, passages []Passage) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("The user has uploaded the document \"%s\". ", filename))
+	sb.WriteString("Relevant excerpts from it are below. When the question is about the document, answer from these excerpts, ")
+	sb.WriteString("and say so plainly if they do not contain the answer instead of guessing. ")
+	sb.WriteString("Cite the page or slide you used in brackets, e.g. (page 3) or (slide 5). ")
+	sb.WriteString("Questions unrelated to the document are answered normally.\n")
+
+	for i, p := range passages {
+		if p.Location != "" {
+			sb.WriteString(fmt.Sprintf("\n[Excerpt %d, %s]\n%s\n", i+1, p.Location, p.Text))
+		} else {
+			sb.WriteString(fmt.Sprintf("\n[Excerpt %d]\n%s\n", i+1, p.Text))
+		}
+	}
+
+	return sb.String()
+}
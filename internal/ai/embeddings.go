@@ -0,0 +1,162 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/nurashi/Newton/internal/config"
+)
+
+// EmbedTask tells the backend whether texts are stored passages or search queries
+type EmbedTask string
+
+const (
+	EmbedDocument EmbedTask = "RETRIEVAL_DOCUMENT"
+	EmbedQuery    EmbedTask = "RETRIEVAL_QUERY"
+)
+
+// Embedder turns texts into vectors for semantic search
+type Embedder interface {
+	// Model identifies the vector space, vectors of different models are not comparable
+	Model() string
+	Embed(ctx context.Context, texts []string, task EmbedTask) ([][]float32, error)
+}
+
+// NewEmbedder builds the embedder selected by cfg.Embeddings.Provider, nil when embeddings are disabled
+func NewEmbedder(cfg *config.Config) (Embedder, error) {
+	var e Embedder
+	switch cfg.Embeddings.Provider {
+	case "":
+		return nil, nil
+	case "gemini":
+		e = &GeminiEmbedder{apiKey: cfg.Gemini.APIKey, model: cfg.Embeddings.Model}
+	case "lmstudio":
+		e = &OpenAIEmbedder{baseURL: strings.TrimSuffix(cfg.LMStudio.URL, "/"), model: cfg.Embeddings.Model}
+	default:
+		return nil, fmt.Errorf("unknown embeddings provider %q", cfg.Embeddings.Provider)
+	}
+
+	return instrumentedEmbedder{Embedder: e, provider: cfg.Embeddings.Provider}, nil
+}
+
+// GeminiEmbedder uses the Gemini batchEmbedContents API
+type GeminiEmbedder struct {
+	apiKey string
+	model  string
+}
+
+type geminiEmbedRequest struct {
+	Model    string        `json:"model"`
+	Content  GeminiContent `json:"content"`
+	TaskType EmbedTask     `json:"taskType,omitempty"`
+}
+
+type geminiEmbedResponse struct {
+	Embeddings []struct {
+		Values []float32 `json:"values"`
+	} `json:"embeddings"`
+}
+
+func (g *GeminiEmbedder) Model() string { return g.model }
+
+func (g *GeminiEmbedder) Embed(ctx context.Context, texts []string, task EmbedTask) ([][]float32, error) {
+	if g.apiKey == "" {
+		return nil, fmt.Errorf("GEMINI_API_KEY not set")
+	}
+
+	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:batchEmbedContents?key=%s", g.model, g.apiKey)
+
+	requests := make([]geminiEmbedRequest, 0, len(texts))
+	for _, t := range texts {
+		requests = append(requests, geminiEmbedRequest{
+			Model:    "models/" + g.model,
+			Content:  GeminiContent{Parts: []GeminiPart{{Text: t}}},
+			TaskType: task,
+		})
+	}
+	reqBody := map[string]any{"requests": requests}
+
+	var vectors [][]float32
+	err := retryWithBackoff(ctx, 4, func() error {
+		body, err := postJSON(ctx, url, nil, reqBody)
+		if err != nil {
+			return err
+		}
+
+		var parsed geminiEmbedResponse
+		if err := json.Unmarshal(body, &parsed); err != nil {
+			return fmt.Errorf("failed to unmarshal response: %w", err)
+		}
+
+		if len(parsed.Embeddings) != len(texts) {
+			return fmt.Errorf("expected %d embeddings, got %d", len(texts), len(parsed.Embeddings))
+		}
+
+		vectors = make([][]float32, len(parsed.Embeddings))
+		for i, e := range parsed.Embeddings {
+			vectors[i] = e.Values
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
+
+// OpenAIEmbedder uses an OpenAI-compatible /embeddings endpoint
+type OpenAIEmbedder struct {
+	baseURL string
+	model   string
+	headers map[string]string
+}
+
+type openAIEmbedResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+func (o *OpenAIEmbedder) Model() string { return o.model }
+
+func (o *OpenAIEmbedder) Embed(ctx context.Context, texts []string, task EmbedTask) ([][]float32, error) {
+	reqBody := map[string]any{
+		"model": o.model,
+		"input": texts,
+	}
+
+	var vectors [][]float32
+	err := retryWithBackoff(ctx, 4, func() error {
+		body, err := postJSON(ctx, o.baseURL+"/embeddings", o.headers, reqBody)
+		if err != nil {
+			return err
+		}
+
+		var parsed openAIEmbedResponse
+		if err := json.Unmarshal(body, &parsed); err != nil {
+			return fmt.Errorf("failed to unmarshal response: %w", err)
+		}
+
+		if len(parsed.Data) != len(texts) {
+			return fmt.Errorf("expected %d embeddings, got %d", len(texts), len(parsed.Data))
+		}
+
+		vectors = make([][]float32, len(texts))
+		for _, d := range parsed.Data {
+			if d.Index < 0 || d.Index >= len(texts) {
+				return fmt.Errorf("embedding index %d out of range", d.Index)
+			}
+			vectors[d.Index] = d.Embedding
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
@@ -1,15 +1,16 @@
 package ai
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
-	"net/http"
-	"os"
+	"log/slog"
+	"strings"
 	"time"
+
+	"github.com/nurashi/Newton/internal/config"
+	"github.com/nurashi/Newton/internal/metrics"
 )
 
 type GeminiContent struct {
@@ -18,11 +19,19 @@ type GeminiContent struct {
 }
 
 type GeminiPart struct {
-	Text string `json:"text"`
+	Text       string      `json:"text,omitempty"`
+	InlineData *GeminiBlob `json:"inlineData,omitempty"`
+}
+
+// GeminiBlob is inline media, Data is base64 encoded when marshalled
+type GeminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     []byte `json:"data"`
 }
 
 type GeminiRequest struct {
-	Contents []GeminiContent `json:"contents"`
+	Contents          []GeminiContent `json:"contents"`
+	SystemInstruction *GeminiContent  `json:"systemInstruction,omitempty"`
 }
 
 type GeminiResponse struct {
@@ -40,8 +49,8 @@ type GeminiResponse struct {
 	} `json:"usageMetadata"`
 }
 
-// retryWithBackoff performs exponential backoff retry
-func retryWithBackoff(maxRetries int, fn func() error) error {
+// retryWithBackoff performs exponential backoff retry, giving up early when ctx is cancelled
+func retryWithBackoff(ctx context.Context, maxRetries int, fn func() error) error {
 	var err error
 	for i := 0; i < maxRetries; i++ {
 		err = fn()
@@ -49,14 +58,20 @@ func retryWithBackoff(maxRetries int, fn func() error) error {
 			return nil
 		}
 
-		if !isRetriableError(err) {
+		if ctx.Err() != nil || !isRetriableError(err) {
 			return err
 		}
 
 		if i < maxRetries-1 {
 			waitTime := time.Duration(1<<uint(i)) * time.Second
-			log.Printf("Retrying after %v due to: %v", waitTime, err)
-			time.Sleep(waitTime)
+			slog.Warn("retrying AI request", "attempt", i+1, "wait_ms", waitTime.Milliseconds(), "error", err)
+			metrics.AIRetriesTotal.Inc()
+
+			select {
+			case <-time.After(waitTime):
+			case <-ctx.Done():
+				return fmt.Errorf("retry aborted: %w", ctx.Err())
+			}
 		}
 	}
 	return fmt.Errorf("max retries exceeded: %w", err)
@@ -97,288 +112,149 @@ func findSubstring(s, substr string) bool {
 	return false
 }
 
-func AskGemini(prompt string) (string, error) {
-	var result string
-	var geminiResp GeminiResponse
-
-	err := retryWithBackoff(4, func() error {
-		apiKey := os.Getenv("GEMINI_API_KEY")
-		if apiKey == "" {
-			return fmt.Errorf("GEMINI_API_KEY not set")
-		}
-
-		model := "gemini-2.5-flash"
-		url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s", model, apiKey)
+// GeminiProvider talks to the Google Gemini generateContent API
+type GeminiProvider struct {
+	apiKey string
+	model  string
+}
 
-		reqBody := GeminiRequest{
-			Contents: []GeminiContent{
-				{
-					Parts: []GeminiPart{
-						{Text: prompt},
-					},
-				},
-			},
-		}
+func NewGeminiProvider(cfg config.Gemini) *GeminiProvider {
+	return &GeminiProvider{apiKey: cfg.APIKey, model: cfg.Model}
+}
 
-		jsonData, err := json.Marshal(reqBody)
-		if err != nil {
-			return fmt.Errorf("failed to marshal request: %w", err)
-		}
+func (g *GeminiProvider) Name() string  { return "gemini" }
+func (g *GeminiProvider) Model() string { return g.model }
 
-		req, err := http.NewRequestWithContext(context.Background(), "POST", url, bytes.NewBuffer(jsonData))
-		if err != nil {
-			return fmt.Errorf("failed to create request: %w", err)
-		}
+func (g *GeminiProvider) Ask(ctx context.Context, prompt string) (*Response, error) {
+	return g.Chat(ctx, []Message{{Role: RoleUser, Content: prompt}})
+}
 
-		req.Header.Set("Content-Type", "application/json")
+// Chat sends conversation history to Google Gemini API
+func (g *GeminiProvider) Chat(ctx context.Context, history []Message) (*Response, error) {
+	if g.apiKey == "" {
+		return nil, fmt.Errorf("GEMINI_API_KEY not set")
+	}
 
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return fmt.Errorf("failed to send request: %w", err)
-		}
-		defer resp.Body.Close()
+	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s", g.model, g.apiKey)
+	reqBody := g.buildRequest(history)
 
-		body, err := io.ReadAll(resp.Body)
+	var result *Response
+	err := retryWithBackoff(ctx, 4, func() error {
+		body, err := postJSON(ctx, url, nil, reqBody)
 		if err != nil {
-			return fmt.Errorf("failed to read response: %w", err)
-		}
-
-		if resp.StatusCode != 200 {
-			return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+			return err
 		}
 
+		var geminiResp GeminiResponse
 		if err := json.Unmarshal(body, &geminiResp); err != nil {
 			return fmt.Errorf("failed to unmarshal response: %w", err)
 		}
 
-		if len(geminiResp.Candidates) == 0 || len(geminiResp.Candidates[0].Content.Parts) == 0 {
-			result = "AI response is empty"
-			return nil
+		result = &Response{
+			Text: "AI response is empty",
+			Usage: Usage{
+				PromptTokens:     geminiResp.UsageMetadata.PromptTokenCount,
+				CompletionTokens: geminiResp.UsageMetadata.CandidatesTokenCount,
+				TotalTokens:      geminiResp.UsageMetadata.TotalTokenCount,
+			},
+		}
+		if len(geminiResp.Candidates) > 0 && len(geminiResp.Candidates[0].Content.Parts) > 0 {
+			result.Text = geminiResp.Candidates[0].Content.Parts[0].Text
 		}
-
-		result = geminiResp.Candidates[0].Content.Parts[0].Text
 		return nil
 	})
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	log.Printf("Gemini tokens: prompt=%d, response=%d, total=%d",
-		geminiResp.UsageMetadata.PromptTokenCount,
-		geminiResp.UsageMetadata.CandidatesTokenCount,
-		geminiResp.UsageMetadata.TotalTokenCount)
-
 	return result, nil
 }
 
-// GenerateEducationalGuide creates a comprehensive educational guide from document text
-func GenerateEducationalGuide(documentText, filename, fileType string) (string, error) {
-	var result string
-	var geminiResp GeminiResponse
-
-	const maxDocText = 8000
-	truncated := false
-
-	if len(documentText) > maxDocText {
-		documentText = documentText[:maxDocText]
-		truncated = true
+// ChatStream sends conversation history to streamGenerateContent and reads the SSE answer
+func (g *GeminiProvider) ChatStream(ctx context.Context, history []Message, onDelta func(delta string)) (*Response, error) {
+	if g.apiKey == "" {
+		return nil, fmt.Errorf("GEMINI_API_KEY not set")
 	}
 
-	truncateNote := ""
-	if truncated {
-		truncateNote = "\n\nNote: Document was truncated due to length. Analysis covers the first part."
-	}
-
-	prompt := fmt.Sprintf(`You are an expert educational content creator. Analyze this %s document titled "%s" and create a comprehensive EDUCATIONAL GUIDE.
-
-DOCUMENT CONTENT:
-%s
-%s
-
-YOUR TASK - Create an Educational Guide with these sections:
-
-## Overview
-Brief summary of what this document is about (2-3 sentences)
-
-## Key Concepts & Definitions
-List and explain the main concepts, terms, and definitions found in the document. Format as:
-• **Term/Concept**: Clear explanation
-
-## Main Topics Covered
-Organized list of the main topics/sections with brief descriptions
-
-## Key Takeaways
-The most important points a learner should remember (numbered list)
-
-## Study Questions
-Generate 3-5 questions that would help test understanding of this material
-
-## How Topics Connect
-Explain how the different concepts in this document relate to each other
-
-## Quick Summary for Review
-A concise recap (3-5 bullet points) perfect for quick revision
-
-Format everything in clean Markdown for Telegram. Be educational, clear, and helpful!`, fileType, filename, documentText, truncateNote)
-
-	err := retryWithBackoff(4, func() error {
-		apiKey := os.Getenv("GEMINI_API_KEY")
-		if apiKey == "" {
-			return fmt.Errorf("GEMINI_API_KEY not set")
-		}
-
-		model := "gemini-2.5-flash"
-		url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s", model, apiKey)
-
-		reqBody := GeminiRequest{
-			Contents: []GeminiContent{
-				{
-					Parts: []GeminiPart{
-						{Text: prompt},
-					},
-				},
-			},
-		}
-
-		jsonData, err := json.Marshal(reqBody)
-		if err != nil {
-			return fmt.Errorf("failed to marshal request: %w", err)
-		}
-
-		req, err := http.NewRequestWithContext(context.Background(), "POST", url, bytes.NewBuffer(jsonData))
-		if err != nil {
-			return fmt.Errorf("failed to create request: %w", err)
-		}
+	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:streamGenerateContent?alt=sse&key=%s", g.model, g.apiKey)
+	reqBody := g.buildRequest(history)
 
-		req.Header.Set("Content-Type", "application/json")
-
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return fmt.Errorf("failed to send request: %w", err)
-		}
-		defer resp.Body.Close()
+	// only opening the stream is retried, a broken stream would repeat already delivered text
+	var body io.ReadCloser
+	err := retryWithBackoff(ctx, 4, func() error {
+		var err error
+		body, err = openStream(ctx, url, nil, reqBody)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
 
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("failed to read response: %w", err)
-		}
+	var text strings.Builder
+	result := &Response{}
 
-		if resp.StatusCode != 200 {
-			return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	err = readSSE(body, func(data []byte) error {
+		var chunk GeminiResponse
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return fmt.Errorf("failed to unmarshal stream chunk: %w", err)
 		}
 
-		if err := json.Unmarshal(body, &geminiResp); err != nil {
-			return fmt.Errorf("failed to unmarshal response: %w", err)
+		if len(chunk.Candidates) > 0 {
+			for _, part := range chunk.Candidates[0].Content.Parts {
+				if part.Text == "" {
+					continue
+				}
+				text.WriteString(part.Text)
+				onDelta(part.Text)
+			}
 		}
 
-		if len(geminiResp.Candidates) == 0 || len(geminiResp.Candidates[0].Content.Parts) == 0 {
-			result = "AI response is empty"
-			return nil
+		// usage is cumulative, the last chunk carries the totals
+		if chunk.UsageMetadata.TotalTokenCount > 0 {
+			result.Usage = Usage{
+				PromptTokens:     chunk.UsageMetadata.PromptTokenCount,
+				CompletionTokens: chunk.UsageMetadata.CandidatesTokenCount,
+				TotalTokens:      chunk.UsageMetadata.TotalTokenCount,
+			}
 		}
-
-		result = geminiResp.Candidates[0].Content.Parts[0].Text
 		return nil
 	})
 
+	result.Text = text.String()
 	if err != nil {
-		return "", err
+		return result, err
 	}
 
-	log.Printf("Educational Guide generated - tokens: prompt=%d, response=%d, total=%d",
-		geminiResp.UsageMetadata.PromptTokenCount,
-		geminiResp.UsageMetadata.CandidatesTokenCount,
-		geminiResp.UsageMetadata.TotalTokenCount)
-
+	if result.Text == "" {
+		result.Text = "AI response is empty"
+	}
 	return result, nil
 }
 
-// AskGeminiWithHistory sends conversation history to Google Gemini API
-func AskGeminiWithHistory(history []Message) (string, error) {
-	var result string
-	var geminiResp GeminiResponse
-
-	err := retryWithBackoff(4, func() error {
-		apiKey := os.Getenv("GEMINI_API_KEY")
-		if apiKey == "" {
-			return fmt.Errorf("GEMINI_API_KEY not set")
-		}
+// buildRequest maps chat roles to Gemini ones, system messages become the system instruction
+func (g *GeminiProvider) buildRequest(history []Message) GeminiRequest {
+	var req GeminiRequest
+	req.Contents = make([]GeminiContent, 0, len(history))
 
-		model := "gemini-2.5-flash"
-		url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s", model, apiKey)
-
-		systemPrompt := "You are a assistant as a Telegram bot. Clear answers and conclusion in a simple words. Keep responses brief and to the point. Also text formatting should be for telegram message.\n\n"
-
-		contents := make([]GeminiContent, 0, len(history))
-		for i, msg := range history {
-			role := msg.Role
-			if msg.Role == "assistant" {
-				role = "model"
+	for _, msg := range history {
+		switch msg.Role {
+		case RoleSystem:
+			if req.SystemInstruction == nil {
+				req.SystemInstruction = &GeminiContent{}
 			}
-
-			text := msg.Content
-
-			if i == 0 && msg.Role == "user" {
-				text = systemPrompt + msg.Content
+			req.SystemInstruction.Parts = append(req.SystemInstruction.Parts, GeminiPart{Text: msg.Content})
+		case RoleAssistant:
+			req.Contents = append(req.Contents, GeminiContent{Parts: []GeminiPart{{Text: msg.Content}}, Role: "model"})
+		default:
+			parts := []GeminiPart{{Text: msg.Content}}
+			for _, img := range msg.Images {
+				parts = append(parts, GeminiPart{InlineData: &GeminiBlob{MimeType: img.MimeType, Data: img.Data}})
 			}
-			contents = append(contents, GeminiContent{
-				Parts: []GeminiPart{{Text: text}},
-				Role:  role,
-			})
-		}
-
-		reqBody := GeminiRequest{
-			Contents: contents,
-		}
-
-		jsonData, err := json.Marshal(reqBody)
-		if err != nil {
-			return fmt.Errorf("failed to marshal request: %w", err)
+			req.Contents = append(req.Contents, GeminiContent{Parts: parts, Role: RoleUser})
 		}
-
-		req, err := http.NewRequestWithContext(context.Background(), "POST", url, bytes.NewBuffer(jsonData))
-		if err != nil {
-			return fmt.Errorf("failed to create request: %w", err)
-		}
-
-		req.Header.Set("Content-Type", "application/json")
-
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return fmt.Errorf("failed to send request: %w", err)
-		}
-		defer resp.Body.Close()
-
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("failed to read response: %w", err)
-		}
-
-		if resp.StatusCode != 200 {
-			return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
-		}
-
-		if err := json.Unmarshal(body, &geminiResp); err != nil {
-			return fmt.Errorf("failed to unmarshal response: %w", err)
-		}
-
-		if len(geminiResp.Candidates) == 0 || len(geminiResp.Candidates[0].Content.Parts) == 0 {
-			result = "AI response is empty"
-			return nil
-		}
-
-		result = geminiResp.Candidates[0].Content.Parts[0].Text
-		return nil
-	})
-
-	if err != nil {
-		return "", err
 	}
 
-	log.Printf("Gemini tokens: prompt=%d, response=%d, total=%d",
-		geminiResp.UsageMetadata.PromptTokenCount,
-		geminiResp.UsageMetadata.CandidatesTokenCount,
-		geminiResp.UsageMetadata.TotalTokenCount)
-
-	return result, nil
+	return req
 }
@@ -0,0 +1,282 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"github.com/nurashi/Newton/internal/documents"
+)
+
+const (
+	// maxDocText is the largest document summarized in a single request, longer ones go through map-reduce
+	maxDocText = 8000
+	// guidePartChars is the target size of one map step, sections are packed together up to it
+	guidePartChars = 6000
+	// maxNotesText is the largest set of notes merged in one reduce step
+	maxNotesText = 24000
+	// guideConcurrency bounds parallel map requests so a big deck doesn't burst the API quota
+	guideConcurrency = 4
+)
+
+// GuideProgress is called after each summarized part of a long document
+type GuideProgress func(done, total int)
+
+// GenerateEducationalGuide creates a comprehensive educational guide from document text.
+// Documents longer than maxDocText are summarized part by part in parallel and the
+// notes are merged into the same guide structure, so nothing is cut off.
+func GenerateEducationalGuide(ctx context.Context, p Provider, documentText, filename, fileType string, onProgress GuideProgress) (string, error) {
+	if len(documentText) <= maxDocText {
+		return askGuide(ctx, p, guidePrompt(fileType, filename, "DOCUMENT CONTENT", documentText))
+	}
+
+	parts := guideParts(documentText)
+	slog.Info("summarizing long document", "filename", filename, "chars", len(documentText), "parts", len(parts))
+
+	notes, err := summarizeParts(ctx, p, parts, filename, fileType, onProgress)
+	if err != nil {
+		return "", err
+	}
+
+	merged, complete, err := reduceNotes(ctx, p, notes, filename, fileType)
+	if err != nil {
+		return "", err
+	}
+
+	guide, err := askGuide(ctx, p, guidePrompt(fileType, filename, "DOCUMENT NOTES (summaries of every section, in order)", merged))
+	if err != nil {
+		return "", err
+	}
+	if !complete {
+		guide += "\n\n" + partialGuideNotice
+	}
+	return guide, nil
+}
+
+// partialGuideNotice ends a guide whose notes had to be cut because the document was too long to condense
+const partialGuideNotice = "⚠️ _This document is too long to condense completely, the guide covers only its first part._"
+
+func guidePrompt(fileType, filename, contentLabel, content string) string {
+	return fmt.Sprintf(`You are an expert educational content creator. Analyze this %s document titled "%s" and create a comprehensive EDUCATIONAL GUIDE.
+
+%s:
+%s
+
+YOUR TASK - Create an Educational Guide with these sections:
+
+## Overview
+Brief summary of what this document is about (2-3 sentences)
+
+## Key Concepts & Definitions
+List and explain the main concepts, terms, and definitions found in the document. Format as:
+• **Term/Concept**: Clear explanation
+
+## Main Topics Covered
+Organized list of the main topics/sections with brief descriptions
+
+## Key Takeaways
+The most important points a learner should remember (numbered list)
+
+## Study Questions
+Generate 3-5 questions that would help test understanding of this material
+
+## How Topics Connect
+Explain how the different concepts in this document relate to each other
+
+## Quick Summary for Review
+A concise recap (3-5 bullet points) perfect for quick revision
+
+Format everything in clean Markdown for Telegram. Be educational, clear, and helpful!`, fileType, filename, contentLabel, content)
+}
+
+func askGuide(ctx context.Context, p Provider, prompt string) (string, error) {
+	resp, err := p.Ask(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+
+	slog.Info("educational guide generated",
+		"provider", p.Name(),
+		"model", p.Model(),
+		"prompt_tokens", resp.Usage.PromptTokens,
+		"completion_tokens", resp.Usage.CompletionTokens,
+		"tokens", resp.Usage.TotalTokens)
+
+	return resp.Text, nil
+}
+
+// guidePart is a run of consecutive sections summarized in one request
+type guidePart struct {
+	label string
+	text  string
+}
+
+// guideParts packs pages/slides into parts of about guidePartChars, splitting oversized sections
+func guideParts(text string) []guidePart {
+	var parts []guidePart
+	var current strings.Builder
+	var first, last string
+
+	flush := func() {
+		if current.Len() == 0 {
+			return
+		}
+		label := first
+		if last != first {
+			label = first + " - " + last
+		}
+		parts = append(parts, guidePart{label: label, text: current.String()})
+		current.Reset()
+	}
+
+	for _, section := range documents.Sections(text) {
+		for _, c := range documents.Split(section.Text, guidePartChars, 0) {
+			if current.Len() > 0 && current.Len()+len(c.Text) > guidePartChars {
+				flush()
+			}
+			if current.Len() == 0 {
+				first = section.Location
+			}
+			last = section.Location
+
+			if section.Location != "" {
+				current.WriteString(fmt.Sprintf("--- %s ---\n", section.Location))
+			}
+			current.WriteString(c.Text)
+			current.WriteString("\n")
+		}
+	}
+	flush()
+
+	return parts
+}
+
+// summarizeParts runs the map step with bounded concurrency, keeping the notes in document order.
+// A part that still fails after the provider's retries is noted instead of failing the whole guide.
+func summarizeParts(ctx context.Context, p Provider, parts []guidePart, filename, fileType string, onProgress GuideProgress) ([]string, error) {
+	notes := make([]string, len(parts))
+	errs := make([]error, len(parts))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	done := 0
+	sem := make(chan struct{}, guideConcurrency)
+
+	for i, part := range parts {
+		wg.Add(1)
+		go func(i int, part guidePart) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			// a panic fails this part only, the other notes still make a guide
+			defer func() {
+				if r := recover(); r != nil {
+					slog.Error("panic while summarizing document part", "filename", filename, "part", i+1, "panic", r, "stack", string(debug.Stack()))
+					errs[i] = fmt.Errorf("panic: %v", r)
+				}
+			}()
+			defer func() {
+				mu.Lock()
+				defer mu.Unlock()
+				done++
+				if onProgress != nil {
+					onProgress(done, len(parts))
+				}
+			}()
+
+			prompt := fmt.Sprintf(`You are preparing study notes for part %d of %d of the %s document "%s".
+Extract from this part, as concise bullet points:
+- key concepts and definitions
+- main points and arguments
+- important facts, formulas and examples
+Keep the page/slide references where a point comes from. Do not add an introduction or conclusion.
+
+CONTENT:
+%s`, i+1, len(parts), fileType, filename, part.text)
+
+			resp, err := p.Ask(ctx, prompt)
+			if err != nil {
+				errs[i] = err
+			} else {
+				notes[i] = resp.Text
+			}
+		}(i, part)
+	}
+	wg.Wait()
+
+	failed := 0
+	for i, err := range errs {
+		if err == nil {
+			notes[i] = labelNotes(parts[i].label, notes[i])
+			continue
+		}
+		failed++
+		slog.Warn("failed to summarize document part", "filename", filename, "part", i+1, "parts", len(parts), "error", err)
+		notes[i] = labelNotes(parts[i].label, "(this part could not be summarized)")
+	}
+
+	if failed == len(parts) {
+		return nil, fmt.Errorf("failed to summarize document: %w", errs[0])
+	}
+
+	return notes, nil
+}
+
+func labelNotes(label, notes string) string {
+	if label == "" {
+		return notes
+	}
+	return fmt.Sprintf("[%s]\n%s", label, notes)
+}
+
+// reduceNotes merges notes until they fit into a single guide request, complete is false when
+// they still didn't fit after maxPasses and only the beginning was kept
+func reduceNotes(ctx context.Context, p Provider, notes []string, filename, fileType string) (merged string, complete bool, err error) {
+	const maxPasses = 3
+
+	for pass := 0; ; pass++ {
+		joined := strings.Join(notes, "\n\n")
+		if len(joined) <= maxNotesText {
+			return joined, true, nil
+		}
+
+		// the model didn't condense enough, keep what fits
+		if pass == maxPasses {
+			kept := documents.Split(joined, maxNotesText, 0)[0].Text
+			slog.Warn("document notes truncated after merging", "filename", filename, "passes", maxPasses, "chars", len(joined), "kept", len(kept))
+			return kept, false, nil
+		}
+
+		var groups [][]string
+		size := 0
+		for _, n := range notes {
+			if len(groups) == 0 || size+len(n) > maxNotesText {
+				groups = append(groups, nil)
+				size = 0
+			}
+			groups[len(groups)-1] = append(groups[len(groups)-1], n)
+			size += len(n)
+		}
+
+		reduced := make([]string, 0, len(groups))
+		for _, g := range groups {
+			prompt := fmt.Sprintf(`Merge these consecutive study notes of the %s document "%s" into one set of concise bullet points.
+Remove repetition but keep every distinct concept, definition and the page/slide references.
+
+NOTES:
+%s`, fileType, filename, strings.Join(g, "\n\n"))
+
+			resp, err := p.Ask(ctx, prompt)
+			if err != nil {
+				return "", false, fmt.Errorf("failed to merge notes: %w", err)
+			}
+			reduced = append(reduced, resp.Text)
+		}
+		notes = reduced
+	}
+}
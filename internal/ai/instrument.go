@@ -0,0 +1,112 @@
+package ai
+
+import (
+	"context"
+	"time"
+
+	"github.com/nurashi/Newton/internal/metrics"
+)
+
+// instrumented records latency, errors and token usage of every call to the wrapped provider
+type instrumented struct {
+	Provider
+}
+
+func (p instrumented) observe(ctx context.Context, operation string, start time.Time, resp *Response, err error) {
+	labels := []string{p.Name(), p.Model(), operation}
+	metrics.Since(metrics.AIRequestDuration.WithLabelValues(labels...), start)
+
+	if err != nil {
+		metrics.AIErrorsTotal.WithLabelValues(labels...).Inc()
+		return
+	}
+	if resp != nil {
+		metrics.AITokensTotal.WithLabelValues(p.Name(), p.Model(), "prompt").Add(float64(resp.Usage.PromptTokens))
+		metrics.AITokensTotal.WithLabelValues(p.Name(), p.Model(), "completion").Add(float64(resp.Usage.CompletionTokens))
+		if m := meterFrom(ctx); m != nil {
+			m.add(resp.Usage)
+		}
+	}
+}
+
+func (p instrumented) Chat(ctx context.Context, history []Message) (*Response, error) {
+	start := time.Now()
+	resp, err := p.Provider.Chat(ctx, history)
+	p.observe(ctx, "chat", start, resp, err)
+	return resp, err
+}
+
+func (p instrumented) ChatStream(ctx context.Context, history []Message, onDelta func(delta string)) (*Response, error) {
+	start := time.Now()
+	resp, err := p.Provider.ChatStream(ctx, history, onDelta)
+	p.observe(ctx, "chat_stream", start, resp, err)
+	return resp, err
+}
+
+func (p instrumented) Ask(ctx context.Context, prompt string) (*Response, error) {
+	start := time.Now()
+	resp, err := p.Provider.Ask(ctx, prompt)
+	p.observe(ctx, "ask", start, resp, err)
+	return resp, err
+}
+
+// instrumentedEmbedder records latency and errors of embedding calls
+type instrumentedEmbedder struct {
+	Embedder
+	provider string
+}
+
+func (e instrumentedEmbedder) Embed(ctx context.Context, texts []string, task EmbedTask) ([][]float32, error) {
+	labels := []string{e.provider, e.Model(), "embed"}
+
+	start := time.Now()
+	vectors, err := e.Embedder.Embed(ctx, texts, task)
+	metrics.Since(metrics.AIRequestDuration.WithLabelValues(labels...), start)
+	if err != nil {
+		metrics.AIErrorsTotal.WithLabelValues(labels...).Inc()
+	}
+	return vectors, err
+}
+
+// instrumentedTranscriber records latency, errors and token usage of transcriptions
+type instrumentedTranscriber struct {
+	Transcriber
+	provider string
+}
+
+func (t instrumentedTranscriber) Transcribe(ctx context.Context, audio Audio) (*Response, error) {
+	labels := []string{t.provider, t.Model(), "transcribe"}
+
+	start := time.Now()
+	resp, err := t.Transcriber.Transcribe(ctx, audio)
+	metrics.Since(metrics.AIRequestDuration.WithLabelValues(labels...), start)
+	if err != nil {
+		metrics.AIErrorsTotal.WithLabelValues(labels...).Inc()
+		return resp, err
+	}
+
+	metrics.AITokensTotal.WithLabelValues(t.provider, t.Model(), "prompt").Add(float64(resp.Usage.PromptTokens))
+	metrics.AITokensTotal.WithLabelValues(t.provider, t.Model(), "completion").Add(float64(resp.Usage.CompletionTokens))
+	if m := meterFrom(ctx); m != nil {
+		m.add(resp.Usage)
+	}
+	return resp, nil
+}
+
+// instrumentedSpeaker records latency and errors of speech synthesis
+type instrumentedSpeaker struct {
+	Speaker
+	provider string
+}
+
+func (s instrumentedSpeaker) Speak(ctx context.Context, text string) (Audio, error) {
+	labels := []string{s.provider, s.Model(), "speak"}
+
+	start := time.Now()
+	audio, err := s.Speaker.Speak(ctx, text)
+	metrics.Since(metrics.AIRequestDuration.WithLabelValues(labels...), start)
+	if err != nil {
+		metrics.AIErrorsTotal.WithLabelValues(labels...).Inc()
+	}
+	return audio, err
+}
@@ -0,0 +1,45 @@
+package ai
+
+import (
+	"context"
+	"sync"
+)
+
+// Meter sums the token usage of every provider call made with a context returned by WithMeter
+type Meter struct {
+	mu    sync.Mutex
+	usage Usage
+}
+
+type meterKey struct{}
+
+// WithMeter returns a context that accounts all provider calls made with it to the returned Meter
+func WithMeter(ctx context.Context) (context.Context, *Meter) {
+	m := &Meter{}
+	return context.WithValue(ctx, meterKey{}, m), m
+}
+
+// Usage is the total so far
+func (m *Meter) Usage() Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.usage
+}
+
+func (m *Meter) add(u Usage) {
+	total := u.TotalTokens
+	if total == 0 {
+		total = u.PromptTokens + u.CompletionTokens
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.usage.PromptTokens += u.PromptTokens
+	m.usage.CompletionTokens += u.CompletionTokens
+	m.usage.TotalTokens += total
+}
+
+func meterFrom(ctx context.Context) *Meter {
+	m, _ := ctx.Value(meterKey{}).(*Meter)
+	return m
+}
@@ -0,0 +1,151 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/nurashi/Newton/internal/config"
+)
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// SystemPrompt is the default instruction prepended to chat conversations
+const SystemPrompt = "You are a assistant as a Telegram bot. Clear answers and conclusion in a simple words. Keep responses brief and to the point. Also text formatting should be for telegram message."
+
+// Usage is the token accounting reported by the provider for one call
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+}
+
+// Response is a completed answer from a provider
+type Response struct {
+	Text  string
+	Usage Usage
+}
+
+// Provider is an LLM backend the bot can talk to
+type Provider interface {
+	// Name is the short provider id, e.g. "gemini"
+	Name() string
+	// Model is the model identifier requests are sent to
+	Model() string
+	// Chat answers the last user turn of history, system messages are passed as instructions
+	Chat(ctx context.Context, history []Message) (*Response, error)
+	// ChatStream is like Chat but calls onDelta with every piece of text as it arrives
+	ChatStream(ctx context.Context, history []Message, onDelta func(delta string)) (*Response, error)
+	// Ask answers a single prompt without any history
+	Ask(ctx context.Context, prompt string) (*Response, error)
+}
+
+// NewProvider builds the provider selected by cfg.AI.Provider
+func NewProvider(cfg *config.Config) (Provider, error) {
+	var p Provider
+	switch cfg.AI.Provider {
+	case "gemini":
+		p = NewGeminiProvider(cfg.Gemini)
+	case "openrouter":
+		p = NewOpenRouterProvider(cfg.OpenRouter)
+	case "lmstudio":
+		p = NewLMStudioProvider(cfg.LMStudio)
+	default:
+		return nil, fmt.Errorf("unknown AI provider %q", cfg.AI.Provider)
+	}
+
+	return instrumented{p}, nil
+}
+
+// WithSystemPrompt returns history prefixed with a system message
+func WithSystemPrompt(prompt string, history []Message) []Message {
+	messages := make([]Message, 0, len(history)+1)
+	messages = append(messages, Message{Role: RoleSystem, Content: prompt})
+	return append(messages, history...)
+}
+
+// postJSON sends payload as JSON and returns the raw body of a 200 response
+func postJSON(ctx context.Context, url string, headers map[string]string, payload any) ([]byte, error) {
+	body, err := openStream(ctx, url, headers, payload)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	return raw, nil
+}
+
+// openStream sends payload as JSON and returns the open body of a 200 response, the caller closes it
+func openStream(ctx context.Context, url string, headers map[string]string, payload any) (io.ReadCloser, error) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	if resp.StatusCode != 200 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	return resp.Body, nil
+}
+
+// readSSE calls onData with the payload of every "data:" line of a server-sent events stream
+func readSSE(body io.Reader, onData func(data []byte) error) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" {
+			continue
+		}
+		if data == "[DONE]" {
+			return nil
+		}
+
+		if err := onData([]byte(data)); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read stream: %w", err)
+	}
+	return nil
+}
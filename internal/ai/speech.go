@@ -0,0 +1,262 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/nurashi/Newton/internal/config"
+)
+
+// transcriptionPrompt asks Gemini for the words of a recording only
+const transcriptionPrompt = "Transcribe this recording word for word in its original language. Reply with the transcript only, or with an empty answer if nothing is said."
+
+// Audio is a recording, e.g. a voice note
+type Audio struct {
+	MimeType string
+	// FileName hints the format to servers that look at the extension, e.g. "voice.ogg"
+	FileName string
+	Data     []byte
+}
+
+// Transcriber turns speech into text
+type Transcriber interface {
+	Model() string
+	Transcribe(ctx context.Context, audio Audio) (*Response, error)
+}
+
+// Speaker synthesizes speech, the audio is OGG/Opus so Telegram shows it as a voice note
+type Speaker interface {
+	Model() string
+	Speak(ctx context.Context, text string) (Audio, error)
+}
+
+// NewTranscriber builds the transcriber selected by cfg.Speech.Transcription.Provider, nil when voice input is disabled
+func NewTranscriber(cfg *config.Config) (Transcriber, error) {
+	backend := cfg.Speech.Transcription
+
+	var t Transcriber
+	switch backend.Provider {
+	case "":
+		return nil, nil
+	case "gemini":
+		model := backend.Model
+		if model == "" {
+			model = cfg.Gemini.Model
+		}
+		t = &GeminiTranscriber{apiKey: cfg.Gemini.APIKey, model: model}
+	case "openai":
+		t = &OpenAITranscriber{baseURL: strings.TrimSuffix(backend.URL, "/"), model: backend.Model, headers: bearer(backend.APIKey)}
+	default:
+		return nil, fmt.Errorf("unknown transcription provider %q", backend.Provider)
+	}
+
+	return instrumentedTranscriber{Transcriber: t, provider: backend.Provider}, nil
+}
+
+// NewSpeaker builds the text-to-speech backend selected by cfg.Speech.TTS.Provider, nil when voice replies are disabled
+func NewSpeaker(cfg *config.Config) (Speaker, error) {
+	backend := cfg.Speech.TTS
+
+	var s Speaker
+	switch backend.Provider {
+	case "":
+		return nil, nil
+	case "openai":
+		s = &OpenAISpeaker{baseURL: strings.TrimSuffix(backend.URL, "/"), model: backend.Model, voice: backend.Voice, headers: bearer(backend.APIKey)}
+	default:
+		return nil, fmt.Errorf("unknown TTS provider %q", backend.Provider)
+	}
+
+	return instrumentedSpeaker{Speaker: s, provider: backend.Provider}, nil
+}
+
+func bearer(apiKey string) map[string]string {
+	if apiKey == "" {
+		return nil
+	}
+	return map[string]string{"Authorization": "Bearer " + apiKey}
+}
+
+// GeminiTranscriber sends the recording as inline audio to generateContent
+type GeminiTranscriber struct {
+	apiKey string
+	model  string
+}
+
+func (g *GeminiTranscriber) Model() string { return g.model }
+
+func (g *GeminiTranscriber) Transcribe(ctx context.Context, audio Audio) (*Response, error) {
+	if g.apiKey == "" {
+		return nil, fmt.Errorf("GEMINI_API_KEY not set")
+	}
+
+	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s", g.model, g.apiKey)
+	reqBody := GeminiRequest{Contents: []GeminiContent{{
+		Role: RoleUser,
+		Parts: []GeminiPart{
+			{Text: transcriptionPrompt},
+			{InlineData: &GeminiBlob{MimeType: audio.MimeType, Data: audio.Data}},
+		},
+	}}}
+
+	var result *Response
+	err := retryWithBackoff(ctx, 4, func() error {
+		body, err := postJSON(ctx, url, nil, reqBody)
+		if err != nil {
+			return err
+		}
+
+		var geminiResp GeminiResponse
+		if err := json.Unmarshal(body, &geminiResp); err != nil {
+			return fmt.Errorf("failed to unmarshal response: %w", err)
+		}
+
+		result = &Response{
+			Usage: Usage{
+				PromptTokens:     geminiResp.UsageMetadata.PromptTokenCount,
+				CompletionTokens: geminiResp.UsageMetadata.CandidatesTokenCount,
+				TotalTokens:      geminiResp.UsageMetadata.TotalTokenCount,
+			},
+		}
+		if len(geminiResp.Candidates) > 0 {
+			for _, part := range geminiResp.Candidates[0].Content.Parts {
+				result.Text += part.Text
+			}
+		}
+		result.Text = strings.TrimSpace(result.Text)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// OpenAITranscriber uses an OpenAI-compatible /audio/transcriptions endpoint, e.g. whisper.cpp server
+type OpenAITranscriber struct {
+	baseURL string
+	model   string
+	headers map[string]string
+}
+
+func (o *OpenAITranscriber) Model() string { return o.model }
+
+func (o *OpenAITranscriber) Transcribe(ctx context.Context, audio Audio) (*Response, error) {
+	var result *Response
+	err := retryWithBackoff(ctx, 4, func() error {
+		body, err := postAudio(ctx, o.baseURL+"/audio/transcriptions", o.headers, o.model, audio)
+		if err != nil {
+			return err
+		}
+
+		var parsed struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(body, &parsed); err != nil {
+			return fmt.Errorf("failed to unmarshal response: %w", err)
+		}
+
+		result = &Response{Text: strings.TrimSpace(parsed.Text)}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// postAudio uploads audio as multipart form data and returns the raw body of a 200 response
+func postAudio(ctx context.Context, url string, headers map[string]string, model string, audio Audio) ([]byte, error) {
+	var buf bytes.Buffer
+	form := multipart.NewWriter(&buf)
+
+	if model != "" {
+		if err := form.WriteField("model", model); err != nil {
+			return nil, fmt.Errorf("failed to write form: %w", err)
+		}
+	}
+	if err := form.WriteField("response_format", "json"); err != nil {
+		return nil, fmt.Errorf("failed to write form: %w", err)
+	}
+
+	file, err := form.CreateFormFile("file", audio.FileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write form: %w", err)
+	}
+	if _, err := file.Write(audio.Data); err != nil {
+		return nil, fmt.Errorf("failed to write form: %w", err)
+	}
+	if err := form.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write form: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, &buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	return body, nil
+}
+
+// OpenAISpeaker uses an OpenAI-compatible /audio/speech endpoint
+type OpenAISpeaker struct {
+	baseURL string
+	model   string
+	voice   string
+	headers map[string]string
+}
+
+func (o *OpenAISpeaker) Model() string { return o.model }
+
+func (o *OpenAISpeaker) Speak(ctx context.Context, text string) (Audio, error) {
+	reqBody := map[string]any{
+		"model":           o.model,
+		"input":           text,
+		"voice":           o.voice,
+		"response_format": "opus",
+	}
+
+	var audio Audio
+	err := retryWithBackoff(ctx, 4, func() error {
+		body, err := postJSON(ctx, o.baseURL+"/audio/speech", o.headers, reqBody)
+		if err != nil {
+			return err
+		}
+
+		audio = Audio{MimeType: "audio/ogg", FileName: "answer.ogg", Data: body}
+		return nil
+	})
+
+	if err != nil {
+		return Audio{}, err
+	}
+	return audio, nil
+}
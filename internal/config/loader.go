@@ -1,24 +1,75 @@
 package config
 
 import (
-	"log"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/nurashi/Newton/internal/logger"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
+	AI         AI         `mapstructure:"ai"`
+	Gemini     Gemini     `mapstructure:"gemini"`
 	OpenRouter OpenRouter `mapstructure:"openrouter"`
+	LMStudio   LMStudio   `mapstructure:"lmstudio"`
+	Embeddings Embeddings `mapstructure:"embeddings"`
+	Speech     Speech     `mapstructure:"speech"`
 	Database   PostgreSQL `mapstructure:"database"`
 	Telegram   Telegram   `mapstructure:"telegram"`
+	Limits     Limits     `mapstructure:"limits"`
+	Metrics    Metrics    `mapstructure:"metrics"`
+	Log        Log        `mapstructure:"log"`
+}
+
+// AI selects which LLM backend the bot talks to: gemini, openrouter or lmstudio
+type AI struct {
+	Provider string `mapstructure:"provider"`
+}
+
+type Gemini struct {
+	APIKey string `mapstructure:"api_key"`
+	Model  string `mapstructure:"model"`
 }
 
 type OpenRouter struct {
+	APIKey  string `mapstructure:"api_key"`
 	Model   string `mapstructure:"model"`
 	Referer string `mapstructure:"referer"`
 }
 
+// LMStudio is any OpenAI-compatible server, URL is the base like http://host:1234/v1
+type LMStudio struct {
+	URL   string `mapstructure:"url"`
+	Model string `mapstructure:"model"`
+}
+
+// Embeddings selects the backend for document retrieval: gemini or lmstudio, empty falls back to keyword search
+type Embeddings struct {
+	Provider string `mapstructure:"provider"`
+	Model    string `mapstructure:"model"`
+}
+
+// Speech configures voice messages, an empty provider disables that direction
+type Speech struct {
+	// Transcription is gemini or openai, any OpenAI-compatible /audio/transcriptions server
+	Transcription SpeechBackend `mapstructure:"transcription"`
+	// TTS is openai, any OpenAI-compatible /audio/speech server, users turn voice replies on with /voice
+	TTS SpeechBackend `mapstructure:"tts"`
+}
+
+// SpeechBackend is one speech service, URL and APIKey are used by openai only
+type SpeechBackend struct {
+	Provider string `mapstructure:"provider"`
+	URL      string `mapstructure:"url"`
+	// Model defaults to gemini.model for gemini transcription
+	Model  string `mapstructure:"model"`
+	APIKey string `mapstructure:"api_key"`
+	// Voice is the TTS voice, e.g. alloy
+	Voice string `mapstructure:"voice"`
+}
+
 type PostgreSQL struct {
 	Host     string `mapstructure:"host"`
 	Port     int    `mapstructure:"port"`
@@ -29,6 +80,58 @@ type PostgreSQL struct {
 
 type Telegram struct {
 	Token string `mapstructure:"token"`
+	// Mode is how updates are received: polling (default) or webhook
+	Mode    string  `mapstructure:"mode"`
+	Webhook Webhook `mapstructure:"webhook"`
+	// Workers bounds how many chats are served at once, updates of one chat are always sequential
+	Workers   int `mapstructure:"workers"`
+	QueueSize int `mapstructure:"queue_size"`
+	// ShutdownTimeout is how long in-flight requests may keep running after SIGTERM
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	// AdminIDs are Telegram user ids with admin rights in addition to users with the admin role
+	AdminIDs []int64 `mapstructure:"admin_ids"`
+	// ErrorChatID is notified of handler panics, 0 disables notifications
+	ErrorChatID int64 `mapstructure:"error_chat_id"`
+}
+
+// Webhook configures the HTTP server Telegram pushes updates to
+type Webhook struct {
+	// URL is the public base URL Telegram calls, e.g. https://bot.example.com
+	URL    string `mapstructure:"url"`
+	Listen string `mapstructure:"listen"`
+	// Path is appended to URL and should contain a hard to guess segment
+	Path string `mapstructure:"path"`
+	// SecretToken is checked against the X-Telegram-Bot-Api-Secret-Token header
+	SecretToken string `mapstructure:"secret_token"`
+	// CertFile and KeyFile enable TLS on the listener, leave empty behind a TLS terminating proxy
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+}
+
+// Limits protect the AI budget from single users, zero disables a limit
+type Limits struct {
+	// UserPerMinute and ChatPerMinute are token bucket rates for AI requests, Burst is the bucket size
+	UserPerMinute int `mapstructure:"user_per_minute"`
+	UserBurst     int `mapstructure:"user_burst"`
+	ChatPerMinute int `mapstructure:"chat_per_minute"`
+	ChatBurst     int `mapstructure:"chat_burst"`
+	// DailyTokens and MonthlyTokens cap AI tokens per user, days and months are UTC
+	DailyTokens   int64 `mapstructure:"daily_tokens"`
+	MonthlyTokens int64 `mapstructure:"monthly_tokens"`
+	// Documents and DocumentChars cap the library of every user, by count and by extracted characters
+	Documents     int   `mapstructure:"documents"`
+	DocumentChars int64 `mapstructure:"document_chars"`
+}
+
+// Metrics configures the HTTP server exposing /metrics and /health, port 0 disables it
+type Metrics struct {
+	Port int `mapstructure:"port"`
+}
+
+// Log configures logging from LOG_LEVEL (debug, info, warn, error) and ENV (development logs as text)
+type Log struct {
+	Level string `mapstructure:"level"`
+	Env   string `mapstructure:"env"`
 }
 
 // platonus
@@ -45,32 +148,130 @@ func Load(path string) *Config {
 
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 
+	viper.SetDefault("telegram.mode", "polling")
+	viper.SetDefault("telegram.webhook.listen", ":8443")
+	viper.SetDefault("telegram.webhook.path", "/telegram/webhook")
+	viper.SetDefault("telegram.workers", 16)
+	viper.SetDefault("telegram.queue_size", 64)
+	viper.SetDefault("telegram.shutdown_timeout", "30s")
+	viper.SetDefault("limits.user_per_minute", 10)
+	viper.SetDefault("limits.user_burst", 5)
+	viper.SetDefault("limits.chat_per_minute", 20)
+	viper.SetDefault("limits.chat_burst", 10)
+	viper.SetDefault("limits.daily_tokens", 200000)
+	viper.SetDefault("limits.monthly_tokens", 3000000)
+	viper.SetDefault("limits.documents", 20)
+	viper.SetDefault("limits.document_chars", 5000000)
+	viper.SetDefault("metrics.port", 9090)
+	viper.SetDefault("log.level", "info")
+	viper.SetDefault("log.env", "production")
+
 	viper.BindEnv("telegram.token", "TELEGRAM_BOT_TOKEN")
+	viper.BindEnv("telegram.workers", "TELEGRAM_WORKERS")
+	viper.BindEnv("telegram.mode", "TELEGRAM_MODE")
+	viper.BindEnv("telegram.admin_ids", "TELEGRAM_ADMIN_IDS")
+	viper.BindEnv("telegram.error_chat_id", "TELEGRAM_ERROR_CHAT_ID")
+	viper.BindEnv("telegram.webhook.url", "TELEGRAM_WEBHOOK_URL")
+	viper.BindEnv("telegram.webhook.listen", "TELEGRAM_WEBHOOK_LISTEN")
+	viper.BindEnv("telegram.webhook.path", "TELEGRAM_WEBHOOK_PATH")
+	viper.BindEnv("telegram.webhook.secret_token", "TELEGRAM_WEBHOOK_SECRET")
+	viper.BindEnv("telegram.webhook.cert_file", "TELEGRAM_WEBHOOK_CERT")
+	viper.BindEnv("telegram.webhook.key_file", "TELEGRAM_WEBHOOK_KEY")
 	viper.BindEnv("database.host", "DB_HOST")
 	viper.BindEnv("database.port", "DB_PORT")
 	viper.BindEnv("database.user", "DB_USER")
 	viper.BindEnv("database.password", "DB_PASSWORD")
 	viper.BindEnv("database.name", "DB_NAME")
-	viper.BindEnv("openrouter.model", "OPENROUTER_API_KEY")
+	viper.BindEnv("ai.provider", "AI_PROVIDER")
+	viper.BindEnv("gemini.api_key", "GEMINI_API_KEY")
+	viper.BindEnv("gemini.model", "GEMINI_MODEL")
+	viper.BindEnv("openrouter.api_key", "OPENROUTER_API_KEY")
+	viper.BindEnv("openrouter.model", "OPENROUTER_MODEL")
+	viper.BindEnv("lmstudio.url", "LM_STUDIO_URL")
+	viper.BindEnv("lmstudio.model", "LM_STUDIO_MODEL")
+	viper.BindEnv("embeddings.provider", "EMBEDDINGS_PROVIDER")
+	viper.BindEnv("embeddings.model", "EMBEDDINGS_MODEL")
+	viper.BindEnv("speech.transcription.provider", "TRANSCRIPTION_PROVIDER")
+	viper.BindEnv("speech.transcription.url", "TRANSCRIPTION_URL")
+	viper.BindEnv("speech.transcription.model", "TRANSCRIPTION_MODEL")
+	viper.BindEnv("speech.transcription.api_key", "TRANSCRIPTION_API_KEY")
+	viper.BindEnv("speech.tts.provider", "TTS_PROVIDER")
+	viper.BindEnv("speech.tts.url", "TTS_URL")
+	viper.BindEnv("speech.tts.model", "TTS_MODEL")
+	viper.BindEnv("speech.tts.api_key", "TTS_API_KEY")
+	viper.BindEnv("speech.tts.voice", "TTS_VOICE")
+	viper.BindEnv("limits.daily_tokens", "AI_DAILY_TOKENS")
+	viper.BindEnv("limits.monthly_tokens", "AI_MONTHLY_TOKENS")
+	viper.BindEnv("limits.documents", "DOCS_PER_USER")
+	viper.BindEnv("limits.document_chars", "DOCS_MAX_CHARS")
+	viper.BindEnv("metrics.port", "METRICS_PORT")
+	viper.BindEnv("log.level", "LOG_LEVEL")
+	viper.BindEnv("log.env", "ENV")
 
 	if err := viper.ReadInConfig(); err != nil {
-		log.Fatalf("Config load error: %v", err)
+		logger.Fatal("Config load error", "error", err)
 	}
 
 	if err := viper.Unmarshal(&App); err != nil {
-		log.Fatalf("Config unmarshal error: %v", err)
+		logger.Fatal("Config unmarshal error", "error", err)
 	}
 	return &App
 }
 
 func (c *Config) Validate() {
 	if c.Telegram.Token == "" {
-		log.Fatal("Missing Telegram token in config")
+		logger.Fatal("Missing Telegram token in config")
+	}
+	switch c.Telegram.Mode {
+	case "polling":
+	case "webhook":
+		if c.Telegram.Webhook.URL == "" || c.Telegram.Webhook.SecretToken == "" {
+			logger.Fatal("Webhook mode needs telegram.webhook.url and telegram.webhook.secret_token in config")
+		}
+		if (c.Telegram.Webhook.CertFile == "") != (c.Telegram.Webhook.KeyFile == "") {
+			logger.Fatal("Webhook TLS needs both cert_file and key_file in config")
+		}
+	default:
+		logger.Fatal("Unknown telegram mode in config", "mode", c.Telegram.Mode)
 	}
 	if c.Database.User == "" || c.Database.Password == "" || c.Database.Name == "" {
-		log.Fatal("Database credentials are incomplete in config")
+		logger.Fatal("Database credentials are incomplete in config")
 	}
-	if c.OpenRouter.Model == "" {
-		log.Fatal("Missing OpenRouter model in config")
+
+	switch c.AI.Provider {
+	case "gemini":
+		if c.Gemini.APIKey == "" || c.Gemini.Model == "" {
+			logger.Fatal("Missing Gemini api key or model in config")
+		}
+	case "openrouter":
+		if c.OpenRouter.APIKey == "" || c.OpenRouter.Model == "" {
+			logger.Fatal("Missing OpenRouter api key or model in config")
+		}
+	case "lmstudio":
+		if c.LMStudio.URL == "" || c.LMStudio.Model == "" {
+			logger.Fatal("Missing LM Studio url or model in config")
+		}
+	default:
+		logger.Fatal("Unknown AI provider in config", "provider", c.AI.Provider)
+	}
+
+	if c.Speech.Transcription.Provider == "openai" && c.Speech.Transcription.URL == "" {
+		logger.Fatal("Missing transcription url in config")
+	}
+	if c.Speech.TTS.Provider == "openai" && (c.Speech.TTS.URL == "" || c.Speech.TTS.Voice == "") {
+		logger.Fatal("Missing TTS url or voice in config")
+	}
+}
+
+// Secrets returns the configured credentials, they are redacted from logs
+func (c *Config) Secrets() []string {
+	return []string{
+		c.Telegram.Token,
+		c.Telegram.Webhook.SecretToken,
+		c.Gemini.APIKey,
+		c.OpenRouter.APIKey,
+		c.Speech.Transcription.APIKey,
+		c.Speech.TTS.APIKey,
+		c.Database.Password,
 	}
 }
@@ -0,0 +1,75 @@
+package documents
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Chunk is a contiguous passage of a document
+type Chunk struct {
+	Index int
+	// Location is where the passage comes from, e.g. "page 3" or "slide 5", empty if unknown
+	Location  string
+	Text      string
+	Embedding []float32
+}
+
+// Split cuts text into passages of at most size bytes, preferring paragraph, line and
+// sentence boundaries, with overlap bytes repeated between neighbours so answers
+// spanning a cut are not lost
+func Split(text string, size, overlap int) []Chunk {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	if overlap >= size {
+		overlap = 0
+	}
+
+	var chunks []Chunk
+	for start := 0; start < len(text); {
+		end := start + size
+		if end >= len(text) {
+			end = len(text)
+		} else {
+			end = cutPoint(text, start, end)
+		}
+
+		passage := strings.TrimSpace(text[start:end])
+		if passage != "" {
+			chunks = append(chunks, Chunk{Index: len(chunks), Text: passage})
+		}
+
+		if end == len(text) {
+			break
+		}
+
+		next := end - overlap
+		if next <= start {
+			next = end
+		}
+		for next < len(text) && !utf8.RuneStart(text[next]) {
+			next++
+		}
+		start = next
+	}
+
+	return chunks
+}
+
+// cutPoint finds the best boundary in text[start:end], falling back to end itself
+func cutPoint(text string, start, end int) int {
+	window := text[start:end]
+	minCut := len(window) / 2
+
+	for _, sep := range []string{"\n\n", "\n", ". ", " "} {
+		if i := strings.LastIndex(window, sep); i > minCut {
+			return start + i + len(sep)
+		}
+	}
+
+	for end > start && !utf8.RuneStart(text[end]) {
+		end--
+	}
+	return end
+}
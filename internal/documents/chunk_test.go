@@ -0,0 +1,107 @@
+package documents
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func chunkTexts(chunks []Chunk) []string {
+	var texts []string
+	for _, c := range chunks {
+		texts = append(texts, c.Text)
+	}
+	return texts
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name          string
+		text          string
+		size, overlap int
+		want          []string
+	}{
+		{"empty", "", 10, 0, nil},
+		{"only whitespace", " \n\t\n ", 10, 0, nil},
+		{"fits", "  Short text.  ", 100, 10, []string{"Short text."}},
+		{"exactly size", "abcdefghij", 10, 0, []string{"abcdefghij"}},
+		{"one byte over", "abcdefghijk", 10, 0, []string{"abcdefghij", "k"}},
+		{"paragraph break", "aaaa aaaa.\n\nbbbb bbbb.", 16, 0, []string{"aaaa aaaa.", "bbbb bbbb."}},
+		{"sentence break", "Alpha beta gamma. Delta epsilon", 24, 0, []string{"Alpha beta gamma.", "Delta epsilon"}},
+		// a break in the first half of the window would leave a tiny chunk
+		{"early break ignored", "ab. cdefghijklmnop", 10, 0, []string{"ab. cdefgh", "ijklmnop"}},
+		{"overlap", "abcdefghij", 4, 2, []string{"abcd", "cdef", "efgh", "ghij"}},
+		{"overlap not below size", "abcdefgh", 4, 4, []string{"abcd", "efgh"}},
+		{"multi-byte hard cut", "ééééé", 3, 0, []string{"é", "é", "é", "é", "é"}},
+		{"multi-byte overlap", "éééé", 4, 1, []string{"éé", "éé"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Split(tt.text, tt.size, tt.overlap)
+			if texts := chunkTexts(got); !reflect.DeepEqual(texts, tt.want) {
+				t.Fatalf("Split(%q, %d, %d) = %q, want %q", tt.text, tt.size, tt.overlap, texts, tt.want)
+			}
+			for i, c := range got {
+				if c.Index != i {
+					t.Errorf("chunk %d has index %d", i, c.Index)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitLimits(t *testing.T) {
+	text := strings.Repeat("Клетка — основная единица жизни. Cells divide by mitosis.\n", 40) +
+		"\n\n" + strings.Repeat("日本語のテキスト", 30)
+
+	for _, size := range []int{7, 16, 64, 255, 1000} {
+		for _, overlap := range []int{0, 1, size / 4, size - 1} {
+			chunks := Split(text, size, overlap)
+			if len(chunks) == 0 {
+				t.Fatalf("Split(size %d, overlap %d) returned no chunks", size, overlap)
+			}
+			for _, c := range chunks {
+				if len(c.Text) > size {
+					t.Errorf("size %d, overlap %d: chunk %d is %d bytes", size, overlap, c.Index, len(c.Text))
+				}
+				if !utf8.ValidString(c.Text) {
+					t.Errorf("size %d, overlap %d: chunk %d cuts a character: %q", size, overlap, c.Index, c.Text)
+				}
+				if !strings.Contains(text, c.Text) {
+					t.Errorf("size %d, overlap %d: chunk %d is not a passage of the text", size, overlap, c.Index)
+				}
+			}
+			if last := chunks[len(chunks)-1].Text; !strings.HasSuffix(text, last) {
+				t.Errorf("size %d, overlap %d: the end of the text is lost, last chunk %q", size, overlap, last)
+			}
+		}
+	}
+}
+
+func TestCutPoint(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		start, end int
+		want       int
+	}{
+		{"paragraph over sentence", "aaaaaaaaaaa\n\nbbbb. cczz", 0, 21, 13},
+		{"line over space", "aaaaaaaaaaa\nbbbb cczz", 0, 19, 12},
+		{"sentence over space", "aaaaaaaaaaa. bbbb cczz", 0, 20, 13},
+		{"space", "aaaaaaaaaaa bbbbbbbbzz", 0, 20, 12},
+		{"no boundary", "aaaaaaaaaaaaaaaaaaaa", 0, 10, 10},
+		{"separator in first half", "a b. cdefghijkl", 0, 10, 10},
+		{"separator before start", "skip. aaaaaaaaaaa bbbbbbbb", 6, 24, 18},
+		{"backs off a split character", "ééééé", 0, 3, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cutPoint(tt.text, tt.start, tt.end); got != tt.want {
+				t.Errorf("cutPoint(%q, %d, %d) = %d, want %d", tt.text, tt.start, tt.end, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package documents
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// stopWords are too common to say anything about relevance
+var stopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "are": true, "but": true, "not": true, "you": true,
+	"all": true, "can": true, "was": true, "one": true, "our": true, "out": true, "has": true,
+	"how": true, "what": true, "why": true, "who": true, "when": true, "where": true, "which": true,
+	"this": true, "that": true, "with": true, "from": true, "have": true, "does": true, "about": true,
+	"into": true, "than": true, "then": true, "them": true, "they": true, "there": true, "their": true,
+	"these": true, "those": true, "will": true, "would": true, "could": true, "should": true,
+	"is": true, "it": true, "in": true, "of": true, "to": true, "a": true, "an": true, "on": true,
+	"me": true, "my": true, "do": true, "be": true, "or": true, "as": true, "at": true, "by": true,
+	"explain": true, "tell": true, "document": true, "please": true,
+}
+
+// Terms returns the lowercase content words of text
+func Terms(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := fields[:0]
+	for _, f := range fields {
+		if len([]rune(f)) < 2 || stopWords[f] {
+			continue
+		}
+		terms = append(terms, f)
+	}
+	return terms
+}
+
+// TopChunks returns up to k chunks most related to query by keyword overlap, in document
+// order and within maxChars in total. When nothing matches the opening chunks are returned,
+// which usually hold the title and introduction.
+func TopChunks(chunks []Chunk, query string, k, maxChars int) []Chunk {
+	queryTerms := Terms(query)
+
+	type scored struct {
+		chunk Chunk
+		score float64
+	}
+
+	ranked := make([]scored, 0, len(chunks))
+	for _, c := range chunks {
+		ranked = append(ranked, scored{chunk: c, score: keywordScore(c.Text, queryTerms)})
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].score > ranked[j].score
+	})
+
+	if len(ranked) > 0 && ranked[0].score == 0 {
+		sort.SliceStable(ranked, func(i, j int) bool {
+			return ranked[i].chunk.Index < ranked[j].chunk.Index
+		})
+	}
+
+	ordered := make([]Chunk, 0, len(ranked))
+	for _, r := range ranked {
+		ordered = append(ordered, r.chunk)
+	}
+
+	return pick(ordered, k, maxChars)
+}
+
+// pick takes the first k ranked chunks that fit into maxChars and restores document order
+func pick(ranked []Chunk, k, maxChars int) []Chunk {
+	var picked []Chunk
+	total := 0
+	for _, c := range ranked {
+		if len(picked) == k {
+			break
+		}
+		if total+len(c.Text) > maxChars && len(picked) > 0 {
+			continue
+		}
+		picked = append(picked, c)
+		total += len(c.Text)
+	}
+
+	sort.Slice(picked, func(i, j int) bool {
+		return picked[i].Index < picked[j].Index
+	})
+
+	return picked
+}
+
+// keywordScore counts query term hits, rewarding distinct terms over repeats of one
+func keywordScore(text string, queryTerms []string) float64 {
+	if len(queryTerms) == 0 {
+		return 0
+	}
+
+	counts := make(map[string]int)
+	for _, t := range Terms(text) {
+		counts[t]++
+	}
+
+	var score float64
+	seen := make(map[string]bool)
+	for _, q := range queryTerms {
+		if seen[q] {
+			continue
+		}
+		seen[q] = true
+		if n := counts[q]; n > 0 {
+			score += 1 + float64(n-1)*0.1
+		}
+	}
+	return score
+}
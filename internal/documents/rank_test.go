@@ -0,0 +1,73 @@
+package documents
+
+import (
+	"reflect"
+	"testing"
+)
+
+func chunkIndexes(chunks []Chunk) []int {
+	var indexes []int
+	for _, c := range chunks {
+		indexes = append(indexes, c.Index)
+	}
+	return indexes
+}
+
+func TestTerms(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", []string{}},
+		{"What is the Photosynthesis of C4 plants? x", []string{"photosynthesis", "c4", "plants"}},
+		{"Ядро клетки, я", []string{"ядро", "клетки"}},
+		{"well-known e-mail", []string{"well", "known", "mail"}},
+	}
+
+	for _, tt := range tests {
+		if got := Terms(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Terms(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTopChunks(t *testing.T) {
+	chunks := []Chunk{
+		{Index: 0, Text: "Introduction to the course"},
+		{Index: 1, Text: "Mitochondria produce energy"},
+		{Index: 2, Text: "Mitochondria mitochondria everywhere"},
+		{Index: 3, Text: "Ribosomes and mitochondria build proteins"},
+	}
+
+	tests := []struct {
+		name        string
+		query       string
+		k, maxChars int
+		want        []int
+	}{
+		{"distinct terms first", "mitochondria ribosomes", 1, 1000, []int{3}},
+		// repeats of a term outrank a single hit
+		{"repeats second", "mitochondria ribosomes", 2, 1000, []int{2, 3}},
+		{"document order", "mitochondria ribosomes", 3, 1000, []int{1, 2, 3}},
+		{"k above chunk count", "mitochondria", 10, 1000, []int{0, 1, 2, 3}},
+		{"no match opens the document", "quantum", 2, 1000, []int{0, 1}},
+		{"stop words only", "what is the", 2, 1000, []int{0, 1}},
+		// chunk 2 would overflow maxChars, the smaller chunk 1 still fits
+		{"skips what overflows", "mitochondria ribosomes", 3, 70, []int{1, 3}},
+		{"best chunk over maxChars", "mitochondria ribosomes", 2, 10, []int{3}},
+		{"zero k", "mitochondria", 0, 1000, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := chunkIndexes(TopChunks(chunks, tt.query, tt.k, tt.maxChars))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TopChunks(%q, %d, %d) = %v, want %v", tt.query, tt.k, tt.maxChars, got, tt.want)
+			}
+		})
+	}
+
+	if got := TopChunks(nil, "mitochondria", 3, 1000); len(got) != 0 {
+		t.Errorf("TopChunks(nil) = %v, want none", got)
+	}
+}
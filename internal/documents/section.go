@@ -0,0 +1,90 @@
+package documents
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Section is an addressable part of a document such as a page or a slide
+type Section struct {
+	Location string
+	Text     string
+}
+
+// sectionMarker matches the "--- Page 3 ---" / "--- Sheet 1: Sales ---" lines that separate sections
+var sectionMarker = regexp.MustCompile(`(?m)^--- ([^\n]{1,120}?) ---$`)
+
+// Sections splits extracted text on section markers, text before the first marker has no location
+func Sections(text string) []Section {
+	matches := sectionMarker.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return []Section{{Text: strings.TrimSpace(text)}}
+	}
+
+	var sections []Section
+	if head := strings.TrimSpace(text[:matches[0][0]]); head != "" {
+		sections = append(sections, Section{Text: head})
+	}
+
+	for i, m := range matches {
+		end := len(text)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+
+		body := strings.TrimSpace(text[m[1]:end])
+		if body == "" {
+			continue
+		}
+
+		sections = append(sections, Section{
+			Location: lowerFirst(text[m[2]:m[3]]),
+			Text:     body,
+		})
+	}
+
+	return sections
+}
+
+// Join renders sections as text with a marker line before every located one, Sections parses it back
+func Join(sections []Section) string {
+	var sb strings.Builder
+	for _, s := range sections {
+		text := strings.TrimSpace(s.Text)
+		if text == "" {
+			continue
+		}
+		if s.Location != "" {
+			sb.WriteString("\n--- " + upperFirst(s.Location) + " ---\n")
+		}
+		sb.WriteString(text)
+		sb.WriteString("\n")
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// lowerFirst turns a marker like "Page 3" into the location "page 3"
+func lowerFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[size:]
+}
+
+func upperFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
+// SplitSections chunks every section separately so a chunk never spans two pages or slides
+func SplitSections(sections []Section, size, overlap int) []Chunk {
+	var chunks []Chunk
+	for _, s := range sections {
+		for _, c := range Split(s.Text, size, overlap) {
+			c.Index = len(chunks)
+			c.Location = s.Location
+			chunks = append(chunks, c)
+		}
+	}
+	return chunks
+}
@@ -0,0 +1,80 @@
+package documents
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSections(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Section
+	}{
+		{"no markers", "  plain text \n", []Section{{Text: "plain text"}}},
+		{"empty", "", []Section{{Text: ""}}},
+		{
+			"head before first marker",
+			"Title\n--- Page 1 ---\nfirst\n--- Page 2 ---\nsecond\n",
+			[]Section{{Text: "Title"}, {Location: "page 1", Text: "first"}, {Location: "page 2", Text: "second"}},
+		},
+		{
+			"empty section skipped",
+			"--- Page 1 ---\n\n--- Sheet 1: Sales ---\nq1 10",
+			[]Section{{Location: "sheet 1: Sales", Text: "q1 10"}},
+		},
+		{
+			"multi-byte location",
+			"--- Énoncé ---\nТекст",
+			[]Section{{Location: "énoncé", Text: "Текст"}},
+		},
+		// a marker has to fill its own line
+		{"inline dashes", "a --- Page 1 --- b", []Section{{Text: "a --- Page 1 --- b"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sections(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Sections(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoinRoundTrip(t *testing.T) {
+	sections := []Section{
+		{Text: "Preface"},
+		{Location: "slide 1: Atoms", Text: "Protons\nNeutrons"},
+		{Location: "slide 2", Text: "  "},
+		{Location: "énoncé", Text: "Текст"},
+	}
+
+	text := Join(sections)
+	want := "Preface\n\n--- Slide 1: Atoms ---\nProtons\nNeutrons\n\n--- Énoncé ---\nТекст"
+	if text != want {
+		t.Fatalf("Join() = %q, want %q", text, want)
+	}
+
+	parsed := Sections(text)
+	wantParsed := []Section{sections[0], sections[1], sections[3]}
+	if !reflect.DeepEqual(parsed, wantParsed) {
+		t.Errorf("Sections(Join()) = %q, want %q", parsed, wantParsed)
+	}
+}
+
+func TestSplitSections(t *testing.T) {
+	sections := []Section{
+		{Location: "page 1", Text: "aaaa aaaa bbbb"},
+		{Location: "page 2", Text: "cccc"},
+		{Location: "page 3"},
+	}
+
+	want := []Chunk{
+		{Index: 0, Location: "page 1", Text: "aaaa aaaa"},
+		{Index: 1, Location: "page 1", Text: "bbbb"},
+		{Index: 2, Location: "page 2", Text: "cccc"},
+	}
+	if got := SplitSections(sections, 10, 0); !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitSections() = %+v, want %+v", got, want)
+	}
+}
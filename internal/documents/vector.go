@@ -0,0 +1,42 @@
+package documents
+
+import (
+	"math"
+	"sort"
+)
+
+// Cosine returns the cosine similarity of two vectors, 0 when they can't be compared
+func Cosine(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// TopChunksByEmbedding returns up to k chunks closest to query, in document order and within maxChars in total
+func TopChunksByEmbedding(chunks []Chunk, query []float32, k, maxChars int) []Chunk {
+	ranked := make([]Chunk, len(chunks))
+	copy(ranked, chunks)
+
+	scores := make(map[int]float64, len(chunks))
+	for _, c := range chunks {
+		scores[c.Index] = Cosine(c.Embedding, query)
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return scores[ranked[i].Index] > scores[ranked[j].Index]
+	})
+
+	return pick(ranked, k, maxChars)
+}
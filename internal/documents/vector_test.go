@@ -0,0 +1,68 @@
+package documents
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestCosine(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float32
+		want float64
+	}{
+		{"identical", []float32{1, 2, 3}, []float32{1, 2, 3}, 1},
+		{"scaled", []float32{1, 2, 3}, []float32{2, 4, 6}, 1},
+		{"orthogonal", []float32{1, 0}, []float32{0, 1}, 0},
+		{"opposite", []float32{1, -1}, []float32{-1, 1}, -1},
+		{"empty", nil, []float32{1}, 0},
+		{"both empty", []float32{}, []float32{}, 0},
+		{"mismatched lengths", []float32{1, 2}, []float32{1, 2, 3}, 0},
+		{"zero vector", []float32{0, 0}, []float32{1, 1}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Cosine(tt.a, tt.b)
+			if math.IsNaN(got) || math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Cosine(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTopChunksByEmbedding(t *testing.T) {
+	chunks := []Chunk{
+		{Index: 0, Text: "far", Embedding: []float32{0, 1}},
+		{Index: 1, Text: "closest", Embedding: []float32{1, 0}},
+		// not embedded, e.g. indexed before embeddings were enabled
+		{Index: 2, Text: "missing"},
+		{Index: 3, Text: "close", Embedding: []float32{1, 0.5}},
+	}
+	query := []float32{1, 0.1}
+
+	tests := []struct {
+		name        string
+		k, maxChars int
+		want        []int
+	}{
+		{"best", 1, 1000, []int{1}},
+		{"document order", 2, 1000, []int{1, 3}},
+		{"unembedded last", 4, 1000, []int{0, 1, 2, 3}},
+		{"maxChars", 2, 7, []int{1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := chunkIndexes(TopChunksByEmbedding(chunks, query, tt.k, tt.maxChars))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TopChunksByEmbedding(k %d, maxChars %d) = %v, want %v", tt.k, tt.maxChars, got, tt.want)
+			}
+		})
+	}
+
+	if chunks[0].Index != 0 || chunks[3].Index != 3 {
+		t.Error("TopChunksByEmbedding reordered its input")
+	}
+}
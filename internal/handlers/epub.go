@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/nurashi/Newton/internal/documents"
+)
+
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type epubPackage struct {
+	Manifest []struct {
+		ID        string `xml:"id,attr"`
+		Href      string `xml:"href,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"manifest>item"`
+	Spine []struct {
+		IDRef  string `xml:"idref,attr"`
+		Linear string `xml:"linear,attr"`
+	} `xml:"spine>itemref"`
+}
+
+// ExtractEPUB reads the chapters of an e-book in reading order, every chapter is one section
+func ExtractEPUB(path string) ([]documents.Section, error) {
+	z, err := openZip(path, "EPUB")
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+
+	var container epubContainer
+	if err := z.readXML("META-INF/container.xml", &container); err != nil {
+		return nil, err
+	}
+	if len(container.Rootfiles) == 0 {
+		return nil, fmt.Errorf("EPUB has no package document")
+	}
+
+	opf := container.Rootfiles[0].FullPath
+	var pkg epubPackage
+	if err := z.readXML(opf, &pkg); err != nil {
+		return nil, err
+	}
+
+	hrefs := make(map[string]string, len(pkg.Manifest))
+	for _, item := range pkg.Manifest {
+		if strings.Contains(item.MediaType, "html") {
+			hrefs[item.ID] = item.Href
+		}
+	}
+
+	var sections []documents.Section
+	for _, ref := range pkg.Spine {
+		href, ok := hrefs[ref.IDRef]
+		if !ok || ref.Linear == "no" {
+			continue
+		}
+		if unescaped, err := url.PathUnescape(href); err == nil {
+			href = unescaped
+		}
+
+		data, err := z.read(resolve(opf, href))
+		if errors.Is(err, errZipTooLarge) {
+			return nil, err
+		}
+		if err != nil {
+			continue
+		}
+
+		title, parts := htmlSections(string(data))
+		var text strings.Builder
+		for _, p := range parts {
+			text.WriteString(p.Text + "\n")
+		}
+		if strings.TrimSpace(text.String()) == "" {
+			continue
+		}
+
+		// the first heading names the chapter better than <title>, which is often the book title
+		for _, p := range parts {
+			if _, heading, ok := strings.Cut(p.Location, ": "); ok {
+				title = heading
+				break
+			}
+		}
+
+		location := fmt.Sprintf("chapter %d", len(sections)+1)
+		if title != "" {
+			location += ": " + shorten(title, maxHeadingLength)
+		}
+		sections = append(sections, documents.Section{Location: location, Text: text.String()})
+	}
+
+	return nonEmpty(sections, "EPUB")
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/nurashi/Newton/internal/documents"
+)
+
+const (
+	// maxZipEntrySize caps a single decompressed part of a DOCX/XLSX/ODT/EPUB file
+	maxZipEntrySize = 50 << 20
+	// maxZipTotalSize caps everything decompressed from one file, a zip bomb may be spread over many parts
+	maxZipTotalSize = 200 << 20
+)
+
+// Format is a document type the bot can read
+type Format struct {
+	// Name is shown to users and used as the metrics label, e.g. "DOCX"
+	Name       string
+	Extensions []string
+	MIMETypes  []string
+	Extract    func(path string) ([]documents.Section, error)
+}
+
+var formats = []Format{
+	{Name: "PDF", Extensions: []string{"pdf"}, MIMETypes: []string{"application/pdf"}, Extract: ExtractPDF},
+	{Name: "PPTX", Extensions: []string{"pptx"}, MIMETypes: []string{"application/vnd.openxmlformats-officedocument.presentationml.presentation"}, Extract: ExtractPPTX},
+	{Name: "DOCX", Extensions: []string{"docx"}, MIMETypes: []string{"application/vnd.openxmlformats-officedocument.wordprocessingml.document"}, Extract: ExtractDOCX},
+	{Name: "XLSX", Extensions: []string{"xlsx"}, MIMETypes: []string{"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"}, Extract: ExtractXLSX},
+	{Name: "ODT", Extensions: []string{"odt"}, MIMETypes: []string{"application/vnd.oasis.opendocument.text"}, Extract: ExtractODT},
+	{Name: "EPUB", Extensions: []string{"epub"}, MIMETypes: []string{"application/epub+zip"}, Extract: ExtractEPUB},
+	{Name: "HTML", Extensions: []string{"html", "htm", "xhtml"}, MIMETypes: []string{"text/html", "application/xhtml+xml"}, Extract: ExtractHTML},
+	{Name: "Markdown", Extensions: []string{"md", "markdown"}, MIMETypes: []string{"text/markdown", "text/x-markdown"}, Extract: ExtractMarkdown},
+	{Name: "CSV", Extensions: []string{"csv", "tsv"}, MIMETypes: []string{"text/csv", "text/tab-separated-values"}, Extract: ExtractCSV},
+	{Name: "TXT", Extensions: []string{"txt", "text", "log"}, MIMETypes: []string{"text/plain"}, Extract: ExtractTXT},
+}
+
+var (
+	formatsByExtension = make(map[string]*Format)
+	formatsByMIMEType  = make(map[string]*Format)
+)
+
+func init() {
+	for i := range formats {
+		f := &formats[i]
+		for _, ext := range f.Extensions {
+			formatsByExtension[ext] = f
+		}
+		for _, mt := range f.MIMETypes {
+			formatsByMIMEType[mt] = f
+		}
+	}
+}
+
+// LookupFormat finds the format of a file by its extension, then by the MIME type Telegram reports
+func LookupFormat(filename, mimeType string) (*Format, bool) {
+	if f, ok := formatsByExtension[GetFileExtension(filename)]; ok {
+		return f, true
+	}
+	if mt, _, err := mime.ParseMediaType(mimeType); err == nil {
+		if f, ok := formatsByMIMEType[mt]; ok {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// SupportedFormats lists the names of all readable formats, e.g. for help texts
+func SupportedFormats() []string {
+	names := make([]string, len(formats))
+	for i, f := range formats {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// errZipTooLarge is returned by every read once a limit is hit, so callers that skip unreadable
+// parts can't keep decompressing
+var errZipTooLarge = errors.New("document too large")
+
+// zipArchive indexes the parts of an OOXML/ODF/EPUB container by name
+type zipArchive struct {
+	*zip.ReadCloser
+	files map[string]*zip.File
+	// total is how much has been decompressed so far
+	total int64
+}
+
+func openZip(filePath, kind string) (*zipArchive, error) {
+	r, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s file: %w", kind, err)
+	}
+
+	files := make(map[string]*zip.File, len(r.File))
+	for _, f := range r.File {
+		files[f.Name] = f
+	}
+	return &zipArchive{ReadCloser: r, files: files}, nil
+}
+
+// read returns a part of the archive, refusing parts that decompress beyond maxZipEntrySize
+// and any part once the archive as a whole went beyond maxZipTotalSize
+func (z *zipArchive) read(name string) ([]byte, error) {
+	f, ok := z.files[name]
+	if !ok {
+		return nil, fmt.Errorf("%s not found", name)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer rc.Close()
+
+	limit := min(maxZipEntrySize, maxZipTotalSize-z.total)
+	data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	z.total += int64(len(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if int64(len(data)) > limit {
+		if limit < maxZipEntrySize {
+			return nil, fmt.Errorf("%w: archive decompresses to more than %d MB", errZipTooLarge, maxZipTotalSize>>20)
+		}
+		return nil, fmt.Errorf("%w: %s is larger than %d MB", errZipTooLarge, name, maxZipEntrySize>>20)
+	}
+	return data, nil
+}
+
+// resolve turns a relationship or manifest target into an archive path relative to base
+func resolve(base, target string) string {
+	if strings.HasPrefix(target, "/") {
+		return strings.TrimPrefix(target, "/")
+	}
+	return path.Join(path.Dir(base), target)
+}
+
+// nonEmpty drops sections without text and fails when nothing is left
+func nonEmpty(sections []documents.Section, kind string) ([]documents.Section, error) {
+	var out []documents.Section
+	for _, s := range sections {
+		s.Text = strings.TrimSpace(s.Text)
+		if s.Text != "" {
+			out = append(out, s)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no text found in %s", kind)
+	}
+	return out, nil
+}
+
+// maxHeadingLength keeps section locations short enough for source footers
+const maxHeadingLength = 60
+
+// sectionBuilder collects lines into sections, each heading starts a new one
+type sectionBuilder struct {
+	sections []documents.Section
+	location string
+	body     strings.Builder
+	headings int
+}
+
+// heading starts a numbered section named after the heading, the heading stays in its text
+func (b *sectionBuilder) heading(kind, title string) {
+	b.flush()
+	b.headings++
+	b.location = fmt.Sprintf("%s %d: %s", kind, b.headings, shorten(title, maxHeadingLength))
+	b.line(title)
+}
+
+func (b *sectionBuilder) line(text string) {
+	if text = strings.TrimSpace(text); text != "" {
+		b.body.WriteString(text)
+		b.body.WriteString("\n")
+	}
+}
+
+func (b *sectionBuilder) flush() {
+	if text := strings.TrimSpace(b.body.String()); text != "" {
+		b.sections = append(b.sections, documents.Section{Location: b.location, Text: text})
+	}
+	b.body.Reset()
+}
+
+func (b *sectionBuilder) done() []documents.Section {
+	b.flush()
+	return b.sections
+}
+
+// shorten collapses whitespace and cuts s to at most n runes
+func shorten(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > n {
+		return strings.TrimSpace(string(r[:n-1])) + "…"
+	}
+	return s
+}
+
+const (
+	// tableSectionRows is how many rows of a sheet or CSV file go into one section
+	tableSectionRows = 50
+	// maxTableRows limits how much of a huge table is read
+	maxTableRows = 5000
+)
+
+// tableSections renders a table with its first row as header, repeated in every section of
+// tableSectionRows rows so each part can be read on its own; prefix names the table, e.g. "sheet 1: Sales"
+func tableSections(prefix string, rows [][]string) []documents.Section {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	header, data := formatRow(rows[0]), rows[1:]
+	omitted := 0
+	if len(data) > maxTableRows {
+		omitted = len(data) - maxTableRows
+		data = data[:maxTableRows]
+	}
+
+	if len(data) <= tableSectionRows {
+		lines := []string{header}
+		for _, row := range data {
+			lines = append(lines, formatRow(row))
+		}
+		return []documents.Section{{Location: prefix, Text: strings.Join(lines, "\n")}}
+	}
+
+	var sections []documents.Section
+	for start := 0; start < len(data); start += tableSectionRows {
+		end := min(start+tableSectionRows, len(data))
+		lines := []string{header}
+		for _, row := range data[start:end] {
+			lines = append(lines, formatRow(row))
+		}
+		if end == len(data) && omitted > 0 {
+			lines = append(lines, fmt.Sprintf("(%d more rows not shown)", omitted))
+		}
+
+		// the header is row 1, data rows are numbered from 2
+		location := fmt.Sprintf("rows %d-%d", start+2, end+1)
+		if prefix != "" {
+			location = prefix + ", " + location
+		}
+		sections = append(sections, documents.Section{Location: location, Text: strings.Join(lines, "\n")})
+	}
+	return sections
+}
+
+// formatRow joins the cells of a table row, trailing empty cells are dropped
+func formatRow(cells []string) string {
+	end := len(cells)
+	for end > 0 && strings.TrimSpace(cells[end-1]) == "" {
+		end--
+	}
+	parts := make([]string, end)
+	for i, c := range cells[:end] {
+		parts[i] = strings.Join(strings.Fields(c), " ")
+	}
+	return strings.Join(parts, " | ")
+}
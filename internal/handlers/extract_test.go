@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"archive/zip"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nurashi/Newton/internal/documents"
+)
+
+// writeFile stores a fixture in the test's temporary directory
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeZip builds an OOXML/ODF/EPUB style container from part names and contents
+func writeZip(t *testing.T, name string, parts map[string]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for part, content := range parts {
+		pw, err := w.Create(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func checkSections(t *testing.T, got []documents.Section, err error, want []documents.Section) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("extract failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sections:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestLookupFormat(t *testing.T) {
+	tests := []struct {
+		filename, mimeType, want string
+	}{
+		{"notes.DOCX", "", "DOCX"},
+		{"page.htm", "", "HTML"},
+		{"data.tsv", "", "CSV"},
+		{"upload", "application/epub+zip", "EPUB"},
+		{"upload", "text/plain; charset=utf-8", "TXT"},
+		{"deck.pptx", "application/pdf", "PPTX"},
+	}
+	for _, tt := range tests {
+		f, ok := LookupFormat(tt.filename, tt.mimeType)
+		if !ok || f.Name != tt.want {
+			t.Errorf("LookupFormat(%q, %q) = %v, %v, want %s", tt.filename, tt.mimeType, f, ok, tt.want)
+		}
+	}
+
+	if f, ok := LookupFormat("archive.zip", "application/zip"); ok {
+		t.Errorf("LookupFormat found %s for a zip file", f.Name)
+	}
+}
+
+func TestExtractTXT(t *testing.T) {
+	path := writeFile(t, "notes.txt", "\xef\xbb\xbfFirst line\r\nSecond line\r\n")
+	got, err := ExtractTXT(path)
+	checkSections(t, got, err, []documents.Section{{Text: "First line\nSecond line"}})
+
+	if _, err := ExtractTXT(writeFile(t, "empty.txt", " \n\n")); err == nil {
+		t.Error("empty file extracted without error")
+	}
+}
+
+func TestExtractMarkdown(t *testing.T) {
+	path := writeFile(t, "readme.md", "Intro text\n\n# Setup\nRun it.\n```\n# not a heading\n```\n## Usage ##\n  indented\n")
+	got, err := ExtractMarkdown(path)
+	checkSections(t, got, err, []documents.Section{
+		{Text: "Intro text"},
+		{Location: "section 1: Setup", Text: "Setup\nRun it.\n```\n# not a heading\n```"},
+		{Location: "section 2: Usage", Text: "Usage\n  indented"},
+	})
+}
+
+func TestExtractCSV(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("name;score\n")
+	for i := 0; i < 60; i++ {
+		sb.WriteString("student;1\n")
+	}
+
+	got, err := ExtractCSV(writeFile(t, "scores.csv", sb.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d sections, want 2", len(got))
+	}
+	if got[0].Location != "rows 2-51" || got[1].Location != "rows 52-61" {
+		t.Errorf("locations = %q, %q", got[0].Location, got[1].Location)
+	}
+	// every part repeats the header so it can be read on its own
+	for _, s := range got {
+		if !strings.HasPrefix(s.Text, "name | score\nstudent | 1") {
+			t.Errorf("section %s starts with %q", s.Location, s.Text[:min(len(s.Text), 30)])
+		}
+	}
+
+	small, err := ExtractCSV(writeFile(t, "small.tsv", "a\tb\n1\t2\n"))
+	checkSections(t, small, err, []documents.Section{{Text: "a | b\n1 | 2"}})
+}
+
+func TestExtractHTML(t *testing.T) {
+	page := `<html><head><title>Page</title><style>p { color: red }</style></head><body>
+<p>Before &amp; after</p>
+<h1>Chapter <b>One</b></h1>
+<p>Text with a < sign</p>
+<script>if (a < b) { alert("x") }</script>
+<table><tr><th>A</th><th>B</th></tr><tr><td>1</td><td>2</td></tr></table>
+<h2>Next</h2><ul><li>item</li></ul>
+</body></html>`
+
+	got, err := ExtractHTML(writeFile(t, "page.html", page))
+	checkSections(t, got, err, []documents.Section{
+		{Text: "Before & after"},
+		{Location: "section 1: Chapter One", Text: "Chapter One\nText with a < sign\nA | B\n1 | 2"},
+		{Location: "section 2: Next", Text: "Next\nitem"},
+	})
+}
+
+func TestExtractDOCX(t *testing.T) {
+	doc := `<?xml version="1.0" encoding="UTF-8"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" xmlns:mc="http://schemas.openxmlformats.org/markup-compatibility/2006">
+<w:body>
+<w:p><w:r><w:t>Preface</w:t></w:r></w:p>
+<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t>Cells</w:t></w:r></w:p>
+<w:p><w:r><w:t xml:space="preserve">Cells are </w:t></w:r><w:r><w:t>small.</w:t></w:r></w:p>
+<w:tbl><w:tr><w:tc><w:p><w:r><w:t>Part</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Role</w:t></w:r></w:p></w:tc></w:tr></w:tbl>
+<w:p><mc:AlternateContent><mc:Choice><w:r><w:t>Box</w:t></w:r></mc:Choice><mc:Fallback><w:r><w:t>Box</w:t></w:r></mc:Fallback></mc:AlternateContent></w:p>
+<w:p><w:pPr><w:pStyle w:val="Heading 2"/></w:pPr><w:r><w:t>Membrane</w:t></w:r></w:p>
+<w:p><w:r><w:t>Lipids</w:t></w:r></w:p>
+</w:body>
+</w:document>`
+
+	got, err := ExtractDOCX(writeZip(t, "bio.docx", map[string]string{"word/document.xml": doc}))
+	checkSections(t, got, err, []documents.Section{
+		{Text: "Preface"},
+		{Location: "section 1: Cells", Text: "Cells\nCells are small.\nPart | Role\nBox"},
+		{Location: "section 2: Membrane", Text: "Membrane\nLipids"},
+	})
+}
+
+func TestExtractODT(t *testing.T) {
+	content := `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0" xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0">
+<office:body><office:text>
+<text:h text:outline-level="1">Intro</text:h>
+<text:p>Two<text:s text:c="2"/>spaces<office:annotation><text:p>a comment</text:p></office:annotation></text:p>
+<text:h text:outline-level="3">Detail</text:h>
+<table:table><table:table-row><table:table-cell><text:p>x</text:p></table:table-cell><table:table-cell><text:p>y</text:p></table:table-cell></table:table-row></table:table>
+<text:h text:outline-level="2">Summary</text:h>
+<text:p>Done</text:p>
+</office:text></office:body>
+</office:document-content>`
+
+	got, err := ExtractODT(writeZip(t, "report.odt", map[string]string{"content.xml": content}))
+	checkSections(t, got, err, []documents.Section{
+		{Location: "section 1: Intro", Text: "Intro\nTwo  spaces\nDetail\nx | y"},
+		{Location: "section 2: Summary", Text: "Summary\nDone"},
+	})
+}
+
+func TestExtractXLSX(t *testing.T) {
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Grades" sheetId="1" r:id="rId1"/><sheet name="Empty" sheetId="2" r:id="rId2"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="/xl/worksheets/sheet2.xml"/>
+</Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><si><t>Name</t></si><si><r><t>Gr</t></r><r><t>ade</t></r></si><si><t>Ann</t></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="s"><v>1</v></c></row>
+<row r="2"><c r="A2" t="s"><v>2</v></c><c r="B2" t="b"><v>1</v></c><c r="C2"><v>4.5</v></c></row>
+<row r="3"><c r="A3" t="inlineStr"><is><t>Bob</t></is></c></row>
+</sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData/></worksheet>`,
+	}
+
+	got, err := ExtractXLSX(writeZip(t, "grades.xlsx", parts))
+	checkSections(t, got, err, []documents.Section{
+		{Location: "sheet 1: Grades", Text: "Name |  | Grade\nAnn | TRUE | 4.5\nBob"},
+	})
+}
+
+func TestExtractEPUB(t *testing.T) {
+	parts := map[string]string{
+		"META-INF/container.xml": `<container><rootfiles><rootfile full-path="OEBPS/content.opf"/></rootfiles></container>`,
+		"OEBPS/content.opf": `<package><manifest>
+<item id="cover" href="cover.xhtml" media-type="application/xhtml+xml"/>
+<item id="c1" href="text/chapter%201.xhtml" media-type="application/xhtml+xml"/>
+<item id="c2" href="text/two.xhtml" media-type="application/xhtml+xml"/>
+<item id="css" href="style.css" media-type="text/css"/>
+</manifest><spine><itemref idref="cover" linear="no"/><itemref idref="c2"/><itemref idref="c1"/><itemref idref="css"/></spine></package>`,
+		"OEBPS/cover.xhtml":          `<html><body><p>Cover</p></body></html>`,
+		"OEBPS/text/chapter 1.xhtml": `<html><head><title>Book</title></head><body><p>No heading here</p></body></html>`,
+		"OEBPS/text/two.xhtml":       `<html><head><title>Book</title></head><body><h1>Origins</h1><p>Long ago</p></body></html>`,
+	}
+
+	got, err := ExtractEPUB(writeZip(t, "book.epub", parts))
+	checkSections(t, got, err, []documents.Section{
+		{Location: "chapter 1: Origins", Text: "Origins\nLong ago"},
+		{Location: "chapter 2: Book", Text: "No heading here"},
+	})
+}
+
+func TestZipArchiveTotalLimit(t *testing.T) {
+	path := writeZip(t, "big.docx", map[string]string{
+		"word/document.xml": strings.Repeat("x", 100),
+		"word/styles.xml":   "small",
+	})
+
+	z, err := openZip(path, "DOCX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer z.Close()
+
+	// pretend earlier parts already used up almost all of the budget
+	z.total = maxZipTotalSize - 10
+	if _, err := z.read("word/document.xml"); !errors.Is(err, errZipTooLarge) {
+		t.Fatalf("read beyond the total limit: err = %v, want errZipTooLarge", err)
+	}
+	if _, err := z.read("word/styles.xml"); !errors.Is(err, errZipTooLarge) {
+		t.Fatalf("read after the total limit: err = %v, want errZipTooLarge", err)
+	}
+}
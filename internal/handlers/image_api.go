@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -18,12 +19,17 @@ type UnsplashPhoto struct {
 	} `json:"user"`
 }
 
-func SendUnsplashPhoto(chatID int64, query string) (string, string, error) {
+func SendUnsplashPhoto(ctx context.Context, chatID int64, query string) (string, string, error) {
 	apiKey := os.Getenv("UNSPlASH_ACESS_KEY")
 	apiURL := fmt.Sprintf("https://api.unsplash.com/photos/random?query=%s&client_id=%s",
 		url.QueryEscape(query), apiKey)
 
-	resp, err := http.Get(apiURL)
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("ERROR: failed to create unsplash request: %v", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return "", "",fmt.Errorf("ERROR: failed to get unsplash photo: %v", err)
 	}
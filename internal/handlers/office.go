@@ -0,0 +1,432 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nurashi/Newton/internal/documents"
+)
+
+// docxHeadingStyle matches the paragraph styles that start a new section, e.g. "Heading1" or "Title"
+var docxHeadingStyle = regexp.MustCompile(`(?i)^(title|heading ?[12])$`)
+
+// tableText collects the cells of a table into " | " separated lines, nested tables are flattened into their cell
+type tableText struct {
+	depth int
+	row   []string
+	cell  strings.Builder
+}
+
+func (t *tableText) text(s string) {
+	if s = strings.TrimSpace(s); s == "" {
+		return
+	}
+	if t.cell.Len() > 0 {
+		t.cell.WriteString(" ")
+	}
+	t.cell.WriteString(s)
+}
+
+func (t *tableText) endCell() {
+	if t.depth == 1 {
+		t.row = append(t.row, t.cell.String())
+		t.cell.Reset()
+	}
+}
+
+func (t *tableText) endRow(out *sectionBuilder) {
+	if t.depth == 1 {
+		out.line(formatRow(t.row))
+		t.row = nil
+	}
+}
+
+// ExtractDOCX reads word/document.xml, every Title/Heading 1/Heading 2 paragraph starts a section
+func ExtractDOCX(path string) ([]documents.Section, error) {
+	z, err := openZip(path, "DOCX")
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+
+	data, err := z.read("word/document.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		out      sectionBuilder
+		table    tableText
+		para     strings.Builder
+		style    string
+		inText   bool
+		skipping int
+	)
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse DOCX: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			// text boxes are stored twice, as drawing and as VML fallback
+			if t.Name.Local == "Fallback" || skipping > 0 {
+				skipping++
+				continue
+			}
+			switch t.Name.Local {
+			case "p":
+				para.Reset()
+				style = ""
+			case "pStyle":
+				style = attr(t, "val")
+			case "t":
+				inText = true
+			case "tab":
+				para.WriteString("\t")
+			case "br", "cr":
+				para.WriteString("\n")
+			case "tbl":
+				table.depth++
+			}
+		case xml.EndElement:
+			if skipping > 0 {
+				skipping--
+				continue
+			}
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text := para.String()
+				switch {
+				case table.depth > 0:
+					table.text(text)
+				case docxHeadingStyle.MatchString(style) && strings.TrimSpace(text) != "":
+					out.heading("section", text)
+				default:
+					out.line(text)
+				}
+			case "tc":
+				table.endCell()
+			case "tr":
+				table.endRow(&out)
+			case "tbl":
+				table.depth--
+			}
+		case xml.CharData:
+			if inText && skipping == 0 {
+				para.Write(t)
+			}
+		}
+	}
+
+	return nonEmpty(out.done(), "DOCX")
+}
+
+// ExtractODT reads content.xml of an OpenDocument text, level 1 and 2 headings start a section
+func ExtractODT(path string) ([]documents.Section, error) {
+	z, err := openZip(path, "ODT")
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+
+	data, err := z.read("content.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		out      sectionBuilder
+		table    tableText
+		para     strings.Builder
+		depth    int
+		level    int
+		skipping int
+	)
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ODT: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			// comments and tracked deletions are not part of the text
+			if t.Name.Local == "annotation" || t.Name.Local == "tracked-changes" || skipping > 0 {
+				skipping++
+				continue
+			}
+			switch t.Name.Local {
+			case "h", "p":
+				// paragraphs nest e.g. inside footnotes, the outermost one is written out
+				if depth == 0 {
+					para.Reset()
+					level = 0
+					if t.Name.Local == "h" {
+						level, _ = strconv.Atoi(attr(t, "outline-level"))
+						if level == 0 {
+							level = 1
+						}
+					}
+				}
+				depth++
+			case "s":
+				n, err := strconv.Atoi(attr(t, "c"))
+				if err != nil || n < 1 {
+					n = 1
+				}
+				para.WriteString(strings.Repeat(" ", n))
+			case "tab":
+				para.WriteString("\t")
+			case "line-break":
+				para.WriteString("\n")
+			case "table":
+				table.depth++
+			}
+		case xml.EndElement:
+			if skipping > 0 {
+				skipping--
+				continue
+			}
+			switch t.Name.Local {
+			case "h", "p":
+				depth--
+				if depth > 0 {
+					para.WriteString(" ")
+					continue
+				}
+				text := para.String()
+				switch {
+				case table.depth > 0:
+					table.text(text)
+				case level == 1 || level == 2:
+					out.heading("section", text)
+				default:
+					out.line(text)
+				}
+			case "table-cell":
+				table.endCell()
+			case "table-row":
+				table.endRow(&out)
+			case "table":
+				table.depth--
+			}
+		case xml.CharData:
+			if depth > 0 && skipping == 0 {
+				para.Write(t)
+			}
+		}
+	}
+
+	return nonEmpty(out.done(), "ODT")
+}
+
+// xlsxText is a shared or inline string, rich text is split into runs
+type xlsxText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var sb strings.Builder
+	for _, r := range t.Runs {
+		sb.WriteString(r.Text)
+	}
+	return sb.String()
+}
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name  string     `xml:"name,attr"`
+		Attrs []xml.Attr `xml:",any,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string   `xml:"r,attr"`
+			Type   string   `xml:"t,attr"`
+			Value  string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// relationships is an OOXML .rels part, it maps relationship ids to the parts they point at
+type relationships struct {
+	Items []struct {
+		ID     string `xml:"Id,attr"`
+		Type   string `xml:"Type,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// relationship is a link from one part to another, Target is resolved to an archive path
+type relationship struct {
+	Type   string
+	Target string
+}
+
+// readRelationships returns the relationships of part by id
+func (z *zipArchive) readRelationships(part string) (map[string]relationship, error) {
+	dir, name := "", part
+	if i := strings.LastIndex(part, "/"); i >= 0 {
+		dir, name = part[:i+1], part[i+1:]
+	}
+
+	var rels relationships
+	if err := z.readXML(dir+"_rels/"+name+".rels", &rels); err != nil {
+		return nil, err
+	}
+
+	targets := make(map[string]relationship, len(rels.Items))
+	for _, r := range rels.Items {
+		targets[r.ID] = relationship{Type: r.Type, Target: resolve(part, r.Target)}
+	}
+	return targets, nil
+}
+
+func (z *zipArchive) readXML(name string, v any) error {
+	data, err := z.read(name)
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return nil
+}
+
+// ExtractXLSX renders every worksheet as a table, in the order of the workbook
+func ExtractXLSX(path string) ([]documents.Section, error) {
+	z, err := openZip(path, "XLSX")
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+
+	var workbook xlsxWorkbook
+	if err := z.readXML("xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+	targets, err := z.readRelationships("xl/workbook.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	// workbooks without text cells have no shared strings part
+	var shared struct {
+		Items []xlsxText `xml:"si"`
+	}
+	if _, ok := z.files["xl/sharedStrings.xml"]; ok {
+		if err := z.readXML("xl/sharedStrings.xml", &shared); err != nil {
+			return nil, err
+		}
+	}
+
+	var sections []documents.Section
+	for i, sheet := range workbook.Sheets {
+		var target string
+		for _, a := range sheet.Attrs {
+			if a.Name.Local == "id" {
+				target = targets[a.Value].Target
+			}
+		}
+		if target == "" {
+			continue
+		}
+
+		var ws xlsxWorksheet
+		err := z.readXML(target, &ws)
+		if errors.Is(err, errZipTooLarge) {
+			return nil, err
+		}
+		if err != nil {
+			// chart sheets have no cells
+			continue
+		}
+
+		var rows [][]string
+		for _, r := range ws.Rows {
+			var row []string
+			for _, c := range r.Cells {
+				var value string
+				switch c.Type {
+				case "s":
+					if n, err := strconv.Atoi(c.Value); err == nil && n >= 0 && n < len(shared.Items) {
+						value = shared.Items[n].String()
+					}
+				case "inlineStr":
+					value = c.Inline.String()
+				case "b":
+					value = map[string]string{"0": "FALSE", "1": "TRUE"}[c.Value]
+				default:
+					value = c.Value
+				}
+
+				col := columnIndex(c.Ref)
+				if col < len(row) {
+					col = len(row)
+				}
+				for len(row) < col {
+					row = append(row, "")
+				}
+				row = append(row, value)
+			}
+			if formatRow(row) != "" {
+				rows = append(rows, row)
+			}
+		}
+
+		sections = append(sections, tableSections(fmt.Sprintf("sheet %d: %s", i+1, shorten(sheet.Name, maxHeadingLength)), rows)...)
+	}
+
+	return nonEmpty(sections, "XLSX")
+}
+
+// columnIndex turns the letters of a cell reference like "AB12" into a zero based column, -1 without letters
+func columnIndex(ref string) int {
+	col := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = col*26 + int(r-'A') + 1
+	}
+	return col - 1
+}
+
+// attr returns the value of the attribute with the given local name
+func attr(el xml.StartElement, name string) string {
+	for _, a := range el.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -1,21 +1,29 @@
 package handlers
 
 import (
-	"archive/zip"
-	"bytes"
-	"encoding/xml"
+	"context"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/nurashi/Newton/internal/documents"
 	"rsc.io/pdf"
 )
 
-func DownloadFile(filepath string, url string) error {
-	resp, err := http.Get(url)
+func DownloadFile(ctx context.Context, filepath string, url string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("ERROR: failed to create request: %v", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
 
 	if err != nil {
 		return fmt.Errorf("ERROR: failed to get response from url: %v", err)
@@ -36,109 +44,248 @@ func DownloadFile(filepath string, url string) error {
 	return err
 }
 
-func ExtractPDFText(path string) (string, error) {
-	r, err := pdf.Open(path)
+// ExtractPDF returns one section per page so answers can cite page numbers
+func ExtractPDF(path string) ([]documents.Section, error) {
+	doc, err := ParsePDF(path)
 	if err != nil {
-		return "", fmt.Errorf("ERROR: failed to open pdf file by path: %v", err)
+		return nil, err
 	}
+	return doc.Sections(), nil
+}
 
-	var buf bytes.Buffer
+// BlockKind tells headings from body text
+type BlockKind int
 
-	for i := 1; i <= r.NumPage(); i++ {
-		p := r.Page(i)
-		if p.V.IsNull() {
-			continue
-		}
+const (
+	BlockParagraph BlockKind = iota
+	BlockHeading
+)
+
+// PDFBlock is a paragraph or a heading of a page
+type PDFBlock struct {
+	Kind     BlockKind
+	Text     string
+	FontSize float64
+}
+
+// PDFPage holds the blocks of a page from top to bottom, Number is the page number in the file
+type PDFPage struct {
+	Number int
+	Blocks []PDFBlock
+}
+
+// PDFDocument is the text of a PDF laid out as pages of headings and paragraphs
+type PDFDocument struct {
+	Pages []PDFPage
+}
 
-		content := p.Content()
-		for _, t := range content.Text {
-			buf.WriteString(t.S)
-			buf.WriteString(" ")
+// Sections renders every page as a "page N" section, headings are prefixed with "## "
+func (d *PDFDocument) Sections() []documents.Section {
+	sections := make([]documents.Section, 0, len(d.Pages))
+	for _, page := range d.Pages {
+		parts := make([]string, len(page.Blocks))
+		for i, block := range page.Blocks {
+			parts[i] = block.Text
+			if block.Kind == BlockHeading {
+				parts[i] = "## " + block.Text
+			}
 		}
+		sections = append(sections, documents.Section{
+			Location: fmt.Sprintf("page %d", page.Number),
+			Text:     strings.Join(parts, "\n\n"),
+		})
 	}
+	return sections
+}
 
-	text := strings.TrimSpace(buf.String())
-	if len(text) == 0 {
-		return "", fmt.Errorf("no text found in PDF")
-	}
+const (
+	// pdfLineTolerance is how far glyphs of one line may be apart vertically, relative to the font size
+	pdfLineTolerance = 0.5
+	// pdfWordGap is the horizontal gap between glyphs that counts as a space, relative to the font size
+	pdfWordGap = 0.15
+	// pdfParagraphGap is the distance between baselines that starts a new paragraph, relative to the font size
+	pdfParagraphGap = 1.6
+	// pdfHeadingScale is how much larger than the body text a line must be to count as a heading
+	pdfHeadingScale = 1.15
+	// pdfMaxHeadingLength keeps large-print paragraphs from being taken for headings
+	pdfMaxHeadingLength = 150
+)
+
+// pdfPageNumber matches running page numbers such as "12", "Page 3" or "3 / 10"
+var pdfPageNumber = regexp.MustCompile(`(?i)^(page\s+)?\d{1,4}(\s*(of|/)\s*\d{1,4})?$`)
 
-	return text, nil
+// pdfLine is a line of text on a page, Y is its baseline
+type pdfLine struct {
+	text     string
+	y        float64
+	fontSize float64
 }
 
-// ExtractPPTXText extracts text from PPTX files
-func ExtractPPTXText(path string) (string, error) {
-	r, err := zip.OpenReader(path)
+// ParsePDF groups the glyphs of every page into lines by their Y coordinate, then into paragraphs and
+// headings by spacing and font size; pages without text are left out
+func ParsePDF(path string) (*PDFDocument, error) {
+	r, err := pdf.Open(path)
 	if err != nil {
-		return "", fmt.Errorf("failed to open PPTX file: %w", err)
+		return nil, fmt.Errorf("failed to open PDF file: %w", err)
 	}
-	defer r.Close()
 
-	var allText strings.Builder
-	slideNum := 0
+	type pageLines struct {
+		number int
+		lines  []pdfLine
+	}
 
-	for _, f := range r.File {
-		if strings.HasPrefix(f.Name, "ppt/slides/slide") && strings.HasSuffix(f.Name, ".xml") {
-			slideNum++
-			text, err := extractTextFromSlideXML(f)
-			if err != nil {
-				continue
-			}
-			if text != "" {
-				allText.WriteString(fmt.Sprintf("\n--- Slide %d ---\n", slideNum))
-				allText.WriteString(text)
-				allText.WriteString("\n")
-			}
+	var pages []pageLines
+	sizes := make(map[float64]int)
+	for i := 1; i <= r.NumPage(); i++ {
+		lines := pdfPageLines(r.Page(i))
+		if len(lines) == 0 {
+			continue
+		}
+		for _, l := range lines {
+			sizes[math.Round(l.fontSize)] += utf8.RuneCountInString(l.text)
 		}
+		pages = append(pages, pageLines{number: i, lines: lines})
 	}
 
-	result := strings.TrimSpace(allText.String())
-	if result == "" {
-		return "", fmt.Errorf("no text found in PPTX")
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("no text found in PDF")
+	}
+
+	// the size most of the text is set in is the body size
+	var body float64
+	for size, n := range sizes {
+		if n > sizes[body] || n == sizes[body] && size < body {
+			body = size
+		}
 	}
 
-	return result, nil
+	doc := &PDFDocument{Pages: make([]PDFPage, 0, len(pages))}
+	for _, p := range pages {
+		doc.Pages = append(doc.Pages, PDFPage{Number: p.number, Blocks: pdfBlocks(p.lines, body)})
+	}
+	return doc, nil
 }
 
-func extractTextFromSlideXML(f *zip.File) (string, error) {
-	rc, err := f.Open()
-	if err != nil {
-		return "", err
+// pdfPageLines returns the lines of a page from top to bottom, running page numbers are dropped
+func pdfPageLines(p pdf.Page) (lines []pdfLine) {
+	// the pdf package panics on some malformed content streams, such a page is skipped
+	defer func() {
+		if r := recover(); r != nil {
+			lines = nil
+		}
+	}()
+
+	if p.V.IsNull() {
+		return nil
 	}
-	defer rc.Close()
 
-	content, err := io.ReadAll(rc)
-	if err != nil {
-		return "", err
+	var glyphs []pdf.Text
+	for _, t := range p.Content().Text {
+		t.FontSize = math.Abs(t.FontSize)
+		if t.FontSize == 0 {
+			t.FontSize = 1
+		}
+		if strings.TrimSpace(t.S) != "" {
+			glyphs = append(glyphs, t)
+		}
 	}
 
-	var texts []string
-	decoder := xml.NewDecoder(bytes.NewReader(content))
+	sort.SliceStable(glyphs, func(i, j int) bool { return glyphs[i].Y > glyphs[j].Y })
 
-	for {
-		token, err := decoder.Token()
-		if err == io.EOF {
-			break
+	var group []pdf.Text
+	flush := func() {
+		if line, ok := pdfJoinLine(group); ok {
+			lines = append(lines, line)
 		}
-		if err != nil {
-			break
+		group = group[:0]
+	}
+	for _, g := range glyphs {
+		if len(group) > 0 && group[0].Y-g.Y > pdfLineTolerance*math.Max(group[0].FontSize, g.FontSize) {
+			flush()
 		}
+		group = append(group, g)
+	}
+	flush()
+
+	if len(lines) > 0 && pdfPageNumber.MatchString(lines[len(lines)-1].text) {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > 0 && pdfPageNumber.MatchString(lines[0].text) {
+		lines = lines[1:]
+	}
+	return lines
+}
+
+// pdfJoinLine orders the glyphs of a line from left to right and puts spaces where they are apart
+func pdfJoinLine(glyphs []pdf.Text) (pdfLine, bool) {
+	if len(glyphs) == 0 {
+		return pdfLine{}, false
+	}
+	sort.SliceStable(glyphs, func(i, j int) bool { return glyphs[i].X < glyphs[j].X })
+
+	var sb strings.Builder
+	line := pdfLine{y: glyphs[0].Y}
+	var prev *pdf.Text
+	for i := range glyphs {
+		g := &glyphs[i]
+		line.fontSize = math.Max(line.fontSize, g.FontSize)
 
-		switch se := token.(type) {
-		case xml.StartElement:
-			if se.Name.Local == "t" {
-				var text string
-				if err := decoder.DecodeElement(&text, &se); err == nil && text != "" {
-					texts = append(texts, text)
-				}
+		if prev != nil {
+			// fake bold draws every glyph twice at almost the same place
+			if prev.W > 0 && g.S == prev.S && math.Abs(g.X-prev.X) < 0.1*g.FontSize {
+				continue
+			}
+			width := prev.W
+			if width <= 0 {
+				width = 0.5 * prev.FontSize
+			}
+			if g.X-(prev.X+width) > pdfWordGap*math.Min(g.FontSize, prev.FontSize) {
+				sb.WriteString(" ")
 			}
 		}
+		sb.WriteString(g.S)
+		prev = g
 	}
 
-	result := strings.Join(texts, " ")
-	re := regexp.MustCompile(`\s+`)
-	result = re.ReplaceAllString(result, " ")
+	line.text = strings.Join(strings.Fields(sb.String()), " ")
+	return line, line.text != ""
+}
+
+// pdfBlocks merges consecutive lines into paragraphs, lines set clearly larger than body are headings
+func pdfBlocks(lines []pdfLine, body float64) []PDFBlock {
+	var blocks []PDFBlock
+	var prev pdfLine
+	for _, l := range lines {
+		kind := BlockParagraph
+		if body > 0 && l.fontSize >= body*pdfHeadingScale && utf8.RuneCountInString(l.text) <= pdfMaxHeadingLength {
+			kind = BlockHeading
+		}
 
-	return strings.TrimSpace(result), nil
+		if len(blocks) > 0 {
+			last := &blocks[len(blocks)-1]
+			sameSize := math.Abs(last.FontSize-l.fontSize) < 0.5
+			near := prev.y-l.y <= pdfParagraphGap*math.Max(prev.fontSize, l.fontSize)
+			if last.Kind == kind && near && (kind == BlockParagraph || sameSize) {
+				last.Text = joinPDFLines(last.Text, l.text)
+				prev = l
+				continue
+			}
+		}
+
+		blocks = append(blocks, PDFBlock{Kind: kind, Text: l.text, FontSize: l.fontSize})
+		prev = l
+	}
+	return blocks
+}
+
+// joinPDFLines continues a paragraph on the next line, words hyphenated across the break are rejoined
+func joinPDFLines(text, next string) string {
+	if strings.HasSuffix(text, "-") && !strings.HasSuffix(text, " -") {
+		if r, _ := utf8.DecodeRuneInString(next); unicode.IsLower(r) {
+			return strings.TrimSuffix(text, "-") + next
+		}
+	}
+	return text + " " + next
 }
 
 // GetFileExtension returns the lowercase file extension
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"rsc.io/pdf"
+
+	"github.com/nurashi/Newton/internal/documents"
+)
+
+func TestJoinPDFLines(t *testing.T) {
+	tests := []struct {
+		text, next, want string
+	}{
+		{"plain", "text", "plain text"},
+		{"hyphen-", "ated", "hyphenated"},
+		// a hyphen before a capital or a digit belongs to the word, e.g. "COVID-" "19"
+		{"COVID-", "19", "COVID- 19"},
+		{"Jean-", "Paul", "Jean- Paul"},
+		// a dash set apart by a space is punctuation
+		{"pros -", "cons", "pros - cons"},
+		{"über-", "ällig", "überällig"},
+	}
+	for _, tt := range tests {
+		if got := joinPDFLines(tt.text, tt.next); got != tt.want {
+			t.Errorf("joinPDFLines(%q, %q) = %q, want %q", tt.text, tt.next, got, tt.want)
+		}
+	}
+}
+
+func TestPDFBlocks(t *testing.T) {
+	lines := []pdfLine{
+		{text: "Cell Biology", y: 760, fontSize: 18},
+		{text: "and Genetics", y: 740, fontSize: 18},
+		{text: "Overview", y: 712, fontSize: 14},
+		{text: "Cells are the basic units of", y: 690, fontSize: 10},
+		{text: "life and were first recog-", y: 678, fontSize: 10},
+		{text: "nized in 1665.", y: 666, fontSize: 10},
+		{text: "A new paragraph starts after a gap.", y: 630, fontSize: 10},
+		{text: "Small print stays body text.", y: 618, fontSize: 9},
+	}
+
+	want := []PDFBlock{
+		{Kind: BlockHeading, Text: "Cell Biology and Genetics", FontSize: 18},
+		{Kind: BlockHeading, Text: "Overview", FontSize: 14},
+		{Kind: BlockParagraph, Text: "Cells are the basic units of life and were first recognized in 1665.", FontSize: 10},
+		{Kind: BlockParagraph, Text: "A new paragraph starts after a gap. Small print stays body text.", FontSize: 10},
+	}
+
+	if got := pdfBlocks(lines, 10); !reflect.DeepEqual(got, want) {
+		t.Errorf("pdfBlocks:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestPDFBlocksWithoutBodySize(t *testing.T) {
+	// without a known body size nothing can stand out as a heading
+	lines := []pdfLine{
+		{text: "Title", y: 700, fontSize: 20},
+		{text: "text", y: 680, fontSize: 20},
+	}
+	got := pdfBlocks(lines, 0)
+	if len(got) != 1 || got[0].Kind != BlockParagraph || got[0].Text != "Title text" {
+		t.Errorf("pdfBlocks = %+v, want one paragraph", got)
+	}
+}
+
+func TestPDFBlocksLongLargeLine(t *testing.T) {
+	long := ""
+	for len(long) <= pdfMaxHeadingLength {
+		long += "large print "
+	}
+	got := pdfBlocks([]pdfLine{{text: long, y: 700, fontSize: 16}}, 10)
+	if len(got) != 1 || got[0].Kind != BlockParagraph {
+		t.Errorf("pdfBlocks = %+v, want a paragraph for a long large line", got)
+	}
+}
+
+func TestPDFJoinLine(t *testing.T) {
+	glyphs := []pdf.Text{
+		// out of order, as content streams often draw them
+		{S: "d", X: 25, Y: 100, W: 5, FontSize: 10},
+		{S: "H", X: 0, Y: 100, W: 5, FontSize: 10},
+		{S: "i", X: 5, Y: 100, W: 5, FontSize: 10},
+		// fake bold draws the glyph again, slightly shifted
+		{S: "i", X: 5.3, Y: 100, W: 5, FontSize: 10},
+		{S: "o", X: 30, Y: 100, W: 5, FontSize: 10},
+		{S: "g", X: 35, Y: 100, W: 5, FontSize: 10},
+	}
+
+	line, ok := pdfJoinLine(glyphs)
+	if !ok || line.text != "Hi dog" || line.fontSize != 10 {
+		t.Errorf("pdfJoinLine = %+v, %v, want \"Hi dog\" at size 10", line, ok)
+	}
+
+	// glyphs without widths keep double letters
+	line, _ = pdfJoinLine([]pdf.Text{
+		{S: "o", X: 0, Y: 100, FontSize: 10},
+		{S: "o", X: 0.5, Y: 100, FontSize: 10},
+	})
+	if line.text != "oo" {
+		t.Errorf("pdfJoinLine without widths = %q, want \"oo\"", line.text)
+	}
+}
+
+func TestPDFDocumentSections(t *testing.T) {
+	doc := PDFDocument{Pages: []PDFPage{
+		{Number: 1, Blocks: []PDFBlock{{Kind: BlockHeading, Text: "Intro"}, {Kind: BlockParagraph, Text: "Hello."}}},
+		{Number: 3, Blocks: []PDFBlock{{Kind: BlockParagraph, Text: "End."}}},
+	}}
+
+	want := []documents.Section{
+		{Location: "page 1", Text: "## Intro\n\nHello."},
+		{Location: "page 3", Text: "End."},
+	}
+	if got := doc.Sections(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Sections() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nurashi/Newton/internal/documents"
+)
+
+// pptxSlidePart matches the slide parts of a deck, used when presentation.xml can't be read
+var pptxSlidePart = regexp.MustCompile(`^ppt/slides/slide(\d+)\.xml$`)
+
+// pptxSkippedPlaceholders hold slide numbers, dates, footers and the slide thumbnail on notes pages
+var pptxSkippedPlaceholders = map[string]bool{"sldNum": true, "dt": true, "ftr": true, "hdr": true, "sldImg": true}
+
+type pptxPresentation struct {
+	Slides []struct {
+		Attrs []xml.Attr `xml:",any,attr"`
+	} `xml:"sldIdLst>sldId"`
+}
+
+// pptxSlide is the text of a slide or a notes page
+type pptxSlide struct {
+	title string
+	body  []string
+}
+
+// ExtractPPTX returns one section per slide in the order of the deck, numbered like in PowerPoint,
+// with its title, text, tables and speaker notes
+func ExtractPPTX(path string) ([]documents.Section, error) {
+	z, err := openZip(path, "PPTX")
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+
+	var sections []documents.Section
+	for i, part := range z.slideOrder() {
+		data, err := z.read(part)
+		if errors.Is(err, errZipTooLarge) {
+			return nil, err
+		}
+		if err != nil {
+			continue
+		}
+		slide, err := parsePPTXSlide(data)
+		if err != nil {
+			continue
+		}
+
+		var notes pptxSlide
+		if rels, err := z.readRelationships(part); err == nil {
+			for _, rel := range rels {
+				if strings.HasSuffix(rel.Type, "/notesSlide") {
+					if data, err := z.read(rel.Target); err == nil {
+						notes, _ = parsePPTXSlide(data)
+					}
+				}
+			}
+		}
+
+		lines := slide.body
+		if slide.title != "" {
+			lines = append([]string{slide.title}, lines...)
+		}
+		if len(notes.body) > 0 {
+			lines = append(lines, "Speaker notes:")
+			lines = append(lines, notes.body...)
+		}
+		if len(lines) == 0 {
+			continue
+		}
+
+		location := fmt.Sprintf("slide %d", i+1)
+		if slide.title != "" {
+			location += ": " + shorten(slide.title, maxHeadingLength)
+		}
+		sections = append(sections, documents.Section{Location: location, Text: strings.Join(lines, "\n")})
+	}
+
+	return nonEmpty(sections, "PPTX")
+}
+
+// slideOrder lists the slide parts as the deck shows them, falling back to the numbers in the part names
+func (z *zipArchive) slideOrder() []string {
+	var pres pptxPresentation
+	rels, err := z.readRelationships("ppt/presentation.xml")
+	if err == nil {
+		err = z.readXML("ppt/presentation.xml", &pres)
+	}
+	if err == nil && len(pres.Slides) > 0 {
+		var parts []string
+		for _, s := range pres.Slides {
+			for _, a := range s.Attrs {
+				if a.Name.Local == "id" && a.Name.Space != "" {
+					if rel, ok := rels[a.Value]; ok {
+						parts = append(parts, rel.Target)
+					}
+				}
+			}
+		}
+		return parts
+	}
+
+	type numbered struct {
+		n    int
+		part string
+	}
+	var slides []numbered
+	for name := range z.files {
+		if m := pptxSlidePart.FindStringSubmatch(name); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			slides = append(slides, numbered{n, name})
+		}
+	}
+	sort.Slice(slides, func(i, j int) bool { return slides[i].n < slides[j].n })
+
+	parts := make([]string, len(slides))
+	for i, s := range slides {
+		parts[i] = s.part
+	}
+	return parts
+}
+
+// parsePPTXSlide collects the paragraphs of the shapes on a slide, the title placeholder separately,
+// and renders tables as " | " separated rows
+func parsePPTXSlide(data []byte) (pptxSlide, error) {
+	var (
+		slide    pptxSlide
+		out      sectionBuilder
+		table    tableText
+		para     strings.Builder
+		shape    []string
+		phType   string
+		inText   bool
+		skipping int
+	)
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return pptxSlide{}, fmt.Errorf("failed to parse slide: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "Fallback" || skipping > 0 {
+				skipping++
+				continue
+			}
+			switch t.Name.Local {
+			case "sp":
+				shape, phType = nil, ""
+			case "ph":
+				phType = attr(t, "type")
+			case "p":
+				para.Reset()
+			case "t":
+				inText = true
+			case "br":
+				para.WriteString("\n")
+			case "tbl":
+				table.depth++
+			}
+		case xml.EndElement:
+			if skipping > 0 {
+				skipping--
+				continue
+			}
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if table.depth > 0 {
+					table.text(para.String())
+				} else if text := strings.TrimSpace(para.String()); text != "" {
+					shape = append(shape, text)
+				}
+			case "sp":
+				switch {
+				case pptxSkippedPlaceholders[phType]:
+				case (phType == "title" || phType == "ctrTitle") && slide.title == "":
+					slide.title = strings.Join(strings.Fields(strings.Join(shape, " ")), " ")
+				default:
+					for _, line := range shape {
+						out.line(line)
+					}
+				}
+				shape = nil
+			case "tc":
+				table.endCell()
+			case "tr":
+				table.endRow(&out)
+			case "tbl":
+				table.depth--
+			}
+		case xml.CharData:
+			if inText && skipping == 0 {
+				para.Write(t)
+			}
+		}
+	}
+
+	if text := strings.TrimSpace(out.body.String()); text != "" {
+		slide.body = strings.Split(text, "\n")
+	}
+	return slide, nil
+}
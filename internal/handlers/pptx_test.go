@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/nurashi/Newton/internal/documents"
+)
+
+const pptxRelsNS = `xmlns="http://schemas.openxmlformats.org/package/2006/relationships"`
+
+// pptxSlideXML is a slide with an optional title placeholder, body paragraphs and a slide number
+func pptxSlideXML(title string, body ...string) string {
+	shapes := ""
+	if title != "" {
+		shapes += fmt.Sprintf(`<p:sp><p:nvSpPr><p:nvPr><p:ph type="title"/></p:nvPr></p:nvSpPr><p:txBody><a:p><a:r><a:t>%s</a:t></a:r></a:p></p:txBody></p:sp>`, title)
+	}
+	shapes += `<p:sp><p:nvSpPr><p:nvPr><p:ph idx="1"/></p:nvPr></p:nvSpPr><p:txBody>`
+	for _, b := range body {
+		shapes += fmt.Sprintf(`<a:p><a:r><a:t>%s</a:t></a:r></a:p>`, b)
+	}
+	shapes += `</p:txBody></p:sp>`
+	shapes += `<p:sp><p:nvSpPr><p:nvPr><p:ph type="sldNum"/></p:nvPr></p:nvSpPr><p:txBody><a:p><a:r><a:t>7</a:t></a:r></a:p></p:txBody></p:sp>`
+
+	return `<p:sld xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main"><p:cSld><p:spTree>` +
+		shapes + `</p:spTree></p:cSld></p:sld>`
+}
+
+func TestSlideOrderFollowsPresentation(t *testing.T) {
+	path := writeZip(t, "deck.pptx", map[string]string{
+		"ppt/presentation.xml": `<p:presentation xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<p:sldIdLst><p:sldId id="256" r:id="rId3"/><p:sldId id="257" r:id="rId2"/></p:sldIdLst></p:presentation>`,
+		"ppt/_rels/presentation.xml.rels": `<Relationships ` + pptxRelsNS + `>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/slide" Target="slides/slide1.xml"/>
+<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/slide" Target="slides/slide2.xml"/>
+</Relationships>`,
+		"ppt/slides/slide1.xml": pptxSlideXML("Moved", "b"),
+		"ppt/slides/slide2.xml": pptxSlideXML("Opening", "a"),
+		// left out of the deck, e.g. a deleted slide whose part remained
+		"ppt/slides/slide3.xml": pptxSlideXML("Orphan"),
+	})
+
+	z, err := openZip(path, "PPTX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer z.Close()
+
+	want := []string{"ppt/slides/slide2.xml", "ppt/slides/slide1.xml"}
+	if got := z.slideOrder(); !reflect.DeepEqual(got, want) {
+		t.Errorf("slideOrder() = %q, want %q", got, want)
+	}
+}
+
+func TestSlideOrderFallsBackToNumbers(t *testing.T) {
+	path := writeZip(t, "deck.pptx", map[string]string{
+		"ppt/slides/slide10.xml":      pptxSlideXML("Ten"),
+		"ppt/slides/slide2.xml":       pptxSlideXML("Two"),
+		"ppt/slides/slide1.xml":       pptxSlideXML("One"),
+		"ppt/slides/_rels/slide1.xml": "not a slide",
+	})
+
+	z, err := openZip(path, "PPTX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer z.Close()
+
+	want := []string{"ppt/slides/slide1.xml", "ppt/slides/slide2.xml", "ppt/slides/slide10.xml"}
+	if got := z.slideOrder(); !reflect.DeepEqual(got, want) {
+		t.Errorf("slideOrder() = %q, want %q", got, want)
+	}
+}
+
+func TestExtractPPTXSpeakerNotes(t *testing.T) {
+	notes := `<p:notes xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main"><p:cSld><p:spTree>
+<p:sp><p:nvSpPr><p:nvPr><p:ph type="sldImg"/></p:nvPr></p:nvSpPr></p:sp>
+<p:sp><p:nvSpPr><p:nvPr><p:ph type="body" idx="1"/></p:nvPr></p:nvSpPr><p:txBody><a:p><a:r><a:t>Mention the history.</a:t></a:r></a:p></p:txBody></p:sp>
+<p:sp><p:nvSpPr><p:nvPr><p:ph type="sldNum"/></p:nvPr></p:nvSpPr><p:txBody><a:p><a:r><a:t>1</a:t></a:r></a:p></p:txBody></p:sp>
+</p:spTree></p:cSld></p:notes>`
+
+	path := writeZip(t, "deck.pptx", map[string]string{
+		"ppt/slides/slide1.xml": pptxSlideXML("Atoms", "Protons", "Neutrons"),
+		"ppt/slides/_rels/slide1.xml.rels": `<Relationships ` + pptxRelsNS + `>
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/slideLayout" Target="../slideLayouts/slideLayout1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/notesSlide" Target="../notesSlides/notesSlide1.xml"/>
+</Relationships>`,
+		"ppt/notesSlides/notesSlide1.xml": notes,
+		"ppt/slides/slide2.xml":           pptxSlideXML("", "No notes here"),
+	})
+
+	got, err := ExtractPPTX(path)
+	checkSections(t, got, err, []documents.Section{
+		{Location: "slide 1: Atoms", Text: "Atoms\nProtons\nNeutrons\nSpeaker notes:\nMention the history."},
+		{Location: "slide 2", Text: "No notes here"},
+	})
+}
@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nurashi/Newton/internal/documents"
+)
+
+// maxTextFileSize caps plain text formats that are read into memory at once
+const maxTextFileSize = 20 << 20
+
+// readTextFile reads a text file as UTF-8, a byte order mark and invalid bytes are dropped
+func readTextFile(path, kind string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s file: %w", kind, err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxTextFileSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s file: %w", kind, err)
+	}
+	if len(data) > maxTextFileSize {
+		return "", fmt.Errorf("%s file is too large", kind)
+	}
+
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		data = bytes.ToValidUTF8(data, nil)
+	}
+	return strings.ReplaceAll(string(data), "\r\n", "\n"), nil
+}
+
+// ExtractTXT returns a plain text file as a single section
+func ExtractTXT(path string) ([]documents.Section, error) {
+	text, err := readTextFile(path, "TXT")
+	if err != nil {
+		return nil, err
+	}
+	return nonEmpty([]documents.Section{{Text: text}}, "TXT")
+}
+
+var (
+	markdownHeading = regexp.MustCompile(`^#{1,2}\s+(.+?)\s*#*\s*$`)
+	markdownFence   = regexp.MustCompile("^\\s*(```|~~~)")
+)
+
+// ExtractMarkdown keeps the Markdown source, every # and ## heading outside code blocks starts a section
+func ExtractMarkdown(path string) ([]documents.Section, error) {
+	text, err := readTextFile(path, "Markdown")
+	if err != nil {
+		return nil, err
+	}
+
+	var out sectionBuilder
+	inCode := false
+	for _, line := range strings.Split(text, "\n") {
+		if markdownFence.MatchString(line) {
+			inCode = !inCode
+		}
+		if m := markdownHeading.FindStringSubmatch(line); m != nil && !inCode {
+			out.heading("section", m[1])
+			continue
+		}
+		// keep blank lines and indentation, they carry meaning in Markdown
+		out.body.WriteString(line + "\n")
+	}
+
+	return nonEmpty(out.done(), "Markdown")
+}
+
+// ExtractCSV renders a CSV or TSV file as a table with its first line as header
+func ExtractCSV(path string) ([]documents.Section, error) {
+	text, err := readTextFile(path, "CSV")
+	if err != nil {
+		return nil, err
+	}
+
+	firstLine, _, _ := strings.Cut(text, "\n")
+	r := csv.NewReader(strings.NewReader(text))
+	r.Comma = csvDelimiter(firstLine)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+
+	var rows [][]string
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CSV: %w", err)
+		}
+		if formatRow(record) != "" {
+			rows = append(rows, record)
+		}
+	}
+
+	return nonEmpty(tableSections("", rows), "CSV")
+}
+
+// csvDelimiter guesses the separator from the header line, Excel exports often use ';'
+func csvDelimiter(header string) rune {
+	best, count := ',', 0
+	for _, d := range []rune{',', ';', '\t', '|'} {
+		if n := strings.Count(header, string(d)); n > count {
+			best, count = d, n
+		}
+	}
+	return best
+}
+
+// ExtractHTML returns the visible text of a web page, <h1> and <h2> start a section
+func ExtractHTML(path string) ([]documents.Section, error) {
+	text, err := readTextFile(path, "HTML")
+	if err != nil {
+		return nil, err
+	}
+
+	_, sections := htmlSections(text)
+	return nonEmpty(sections, "HTML")
+}
+
+var (
+	// htmlBlockTags end the current line of text
+	htmlBlockTags = map[string]bool{
+		"address": true, "article": true, "aside": true, "blockquote": true, "br": true, "dd": true,
+		"div": true, "dl": true, "dt": true, "figcaption": true, "footer": true, "form": true,
+		"h3": true, "h4": true, "h5": true, "h6": true, "header": true, "hr": true, "li": true,
+		"main": true, "nav": true, "ol": true, "p": true, "pre": true, "section": true,
+		"table": true, "tr": true, "ul": true,
+	}
+	// htmlHiddenTags have content that is never shown as text
+	htmlHiddenTags = map[string]bool{"script": true, "style": true, "noscript": true, "template": true, "svg": true}
+)
+
+// htmlSections is a small tolerant tokenizer for visible text, it returns the <title> and the sections
+func htmlSections(src string) (string, []documents.Section) {
+	var (
+		out       sectionBuilder
+		line      strings.Builder
+		heading   strings.Builder
+		title     string
+		inHeading bool
+	)
+
+	flush := func() {
+		text := strings.TrimSuffix(strings.Join(strings.Fields(line.String()), " "), " |")
+		out.line(strings.TrimPrefix(text, "| "))
+		line.Reset()
+	}
+
+	for len(src) > 0 {
+		lt := strings.IndexByte(src, '<')
+		if lt < 0 {
+			lt = len(src)
+		}
+		if lt > 0 {
+			text := html.UnescapeString(src[:lt])
+			if inHeading {
+				heading.WriteString(text)
+			} else {
+				line.WriteString(text)
+			}
+			src = src[lt:]
+			continue
+		}
+
+		if strings.HasPrefix(src, "<!--") {
+			end := strings.Index(src, "-->")
+			if end < 0 {
+				break
+			}
+			src = src[end+3:]
+			continue
+		}
+
+		// a '<' that doesn't open a tag is text, e.g. "a < b"
+		if len(src) < 2 || !(isASCIILetter(src[1]) || src[1] == '/' || src[1] == '!' || src[1] == '?') {
+			line.WriteString("<")
+			src = src[1:]
+			continue
+		}
+
+		end := tagEnd(src)
+		if end < 0 {
+			break
+		}
+		tag := src[1:end]
+		src = src[end+1:]
+
+		closing := strings.HasPrefix(tag, "/")
+		name := strings.ToLower(strings.TrimLeft(tag, "/"))
+		if i := strings.IndexAny(name, " \t\r\n/"); i >= 0 {
+			name = name[:i]
+		}
+		if name == "" || strings.HasPrefix(name, "!") || strings.HasPrefix(name, "?") {
+			continue
+		}
+
+		switch {
+		case !closing && (htmlHiddenTags[name] || name == "title"):
+			// skip to the closing tag, the content may contain '<'
+			closeAt := strings.Index(strings.ToLower(src), "</"+name)
+			if closeAt < 0 {
+				src = ""
+				continue
+			}
+			if name == "title" {
+				title = strings.Join(strings.Fields(html.UnescapeString(src[:closeAt])), " ")
+			}
+			src = src[closeAt:]
+		case name == "h1" || name == "h2":
+			flush()
+			if closing && inHeading {
+				if text := strings.TrimSpace(heading.String()); text != "" {
+					out.heading("section", text)
+				}
+				heading.Reset()
+			}
+			inHeading = !closing
+		case name == "td" || name == "th":
+			if closing {
+				line.WriteString(" | ")
+			}
+		case htmlBlockTags[name]:
+			flush()
+		}
+	}
+	flush()
+	if inHeading {
+		out.line(heading.String())
+	}
+
+	return title, out.done()
+}
+
+// tagEnd finds the '>' closing the tag at the start of s, quoted attribute values may contain '>'
+func tagEnd(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return i
+		}
+	}
+	return -1
+}
+
+func isASCIILetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
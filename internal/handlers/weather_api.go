@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -22,11 +23,16 @@ type WheatherResponse struct {
 	} `json:"current"`
 }
 
-func GetWeather(city string) (string, error) {
+func GetWeather(ctx context.Context, city string) (string, error) {
 	apiKey := os.Getenv("WHETHER_API_KEY")
 	url := fmt.Sprintf("https://api.weatherapi.com/v1/current.json?key=%s&q=%s", apiKey, city)
 
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("ERROR: failed to create weather request: %v", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
 
 	if err != nil {
 		return "", fmt.Errorf("ERROR: failed to get resp from weather api: %v", err)
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+const (
+	BroadcastRunning   = "running"
+	BroadcastDone      = "done"
+	BroadcastCancelled = "cancelled"
+)
+
+const (
+	DeliverySent    = "sent"
+	DeliveryBlocked = "blocked"
+	DeliveryFailed  = "failed"
+)
+
+type Broadcast struct {
+	ID         int64      `json:"id"`
+	CreatedBy  int64      `json:"created_by"`
+	ChatID     int64      `json:"chat_id"`
+	Text       string     `json:"text"`
+	Status     string     `json:"status"`
+	Cursor     int64      `json:"cursor"`
+	Sent       int64      `json:"sent"`
+	Blocked    int64      `json:"blocked"`
+	Failed     int64      `json:"failed"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// ChatSettings are the preferences of a chat, the zero value is the default behavior
+type ChatSettings struct {
+	ChatID           int64     `json:"chat_id"`
+	DisabledCommands []string  `json:"disabled_commands"`
+	Language         *string   `json:"language"`
+	Persona          *string   `json:"persona"`
+	UpdatedBy        *int64    `json:"updated_by"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
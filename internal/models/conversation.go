@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+type Conversation struct {
+	ID        int64      `json:"id"`
+	ChatID    int64      `json:"chat_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ClearedAt *time.Time `json:"cleared_at"`
+}
+
+type ConversationMessage struct {
+	ID             int64  `json:"id"`
+	ConversationID int64  `json:"conversation_id"`
+	UserID         *int64 `json:"user_id"`
+	// AuthorName is the sender's first name, used to tell speakers apart in groups
+	AuthorName *string `json:"author_name"`
+	Role       string  `json:"role"`
+	Content    string  `json:"content"`
+	// ImageFileID is the Telegram file id of a photo the message was sent with
+	ImageFileID *string   `json:"image_file_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
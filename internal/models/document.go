@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+type Document struct {
+	ID        int64   `json:"id"`
+	ChatID    int64   `json:"chat_id"`
+	UserID    *int64  `json:"user_id"`
+	Filename  string  `json:"filename"`
+	FileType  string  `json:"file_type"`
+	CharCount int     `json:"char_count"`
+	FileID    *string `json:"file_id"`
+	// Content is the extracted text, it is written by Create and read with DocumentRepository.Content only
+	Content   string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	// ChunkCount and Embedded describe the stored chunks, they are filled when documents are read
+	ChunkCount int  `json:"chunk_count"`
+	Embedded   bool `json:"embedded"`
+}
+
+type DocumentChunk struct {
+	ID             int64     `json:"id"`
+	DocumentID     int64     `json:"document_id"`
+	ChunkIndex     int       `json:"chunk_index"`
+	Location       *string   `json:"location"`
+	Content        string    `json:"content"`
+	Embedding      []float32 `json:"embedding"`
+	EmbeddingModel *string   `json:"embedding_model"`
+}
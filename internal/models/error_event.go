@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// ErrorEvent is a panic recovered while handling an update
+type ErrorEvent struct {
+	ID         string    `json:"id"`
+	ChatID     *int64    `json:"chat_id"`
+	UserID     *int64    `json:"user_id"`
+	UpdateType string    `json:"update_type"`
+	Command    *string   `json:"command"`
+	Message    string    `json:"message"`
+	Stack      string    `json:"stack"`
+	CreatedAt  time.Time `json:"created_at"`
+}
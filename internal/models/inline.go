@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Inline result kinds, the prefix of their result id
+const (
+	InlineAI      = "ai"
+	InlineWeather = "weather"
+	InlinePhoto   = "photo"
+)
+
+// InlineChoice is an inline result a user sent to a chat
+type InlineChoice struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	ResultID  string    `json:"result_id"`
+	Kind      string    `json:"kind"`
+	Query     string    `json:"query"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,7 @@
+package models
+
+// UsageTotals is the AI token usage of a user in the current day and month
+type UsageTotals struct {
+	Day   int64 `json:"day"`
+	Month int64 `json:"month"`
+}
@@ -2,18 +2,49 @@ package models
 
 import "time"
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
-	ID           int64     `json:"id"`
-	Username     *string   `json:"username"`
-	FirstName    string    `json:"first_name"`
-	LastName     *string   `json:"last_name"`
-	IsBot        bool      `json:"is_bot"`
-	LanguageCode *string   `json:"language_code"`
-	MessageCount int       `json:"message_count"`
+	ID           int64   `json:"id"`
+	Username     *string `json:"username"`
+	FirstName    string  `json:"first_name"`
+	LastName     *string `json:"last_name"`
+	IsBot        bool    `json:"is_bot"`
+	LanguageCode *string `json:"language_code"`
+	MessageCount int     `json:"message_count"`
+	Role         string  `json:"role"`
+	// BannedAt is set while the user is banned, their updates are ignored
+	BannedAt *time.Time `json:"banned_at"`
+	// DailyTokens overrides the configured daily AI token limit
+	DailyTokens *int64 `json:"daily_tokens"`
+	// VoiceReplies makes answers to voice messages come back as voice too
+	VoiceReplies bool      `json:"voice_replies"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 	LastSeen     time.Time `json:"last_seen"`
 }
+
+// UserStats are the aggregates operators used to query from sql_queries/check_message_stats.sql
+type UserStats struct {
+	TotalUsers    int64
+	TotalMessages int64
+	AvgMessages   float64
+	MaxMessages   int
+	SilentUsers   int64
+	BannedUsers   int64
+	TopUsers      []User
+	RecentSignups []SignupDay
+}
+
+// SignupDay is how many users registered on a day and how much they have written since
+type SignupDay struct {
+	Date     time.Time
+	NewUsers int64
+	Messages int64
+}
 type TelegramUser struct {
 	ID           int64   `json:"id"`
 	Username     *string `json:"username"`
@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nurashi/Newton/internal/models"
+)
+
+// broadcastColumns are selected in the order query scans them
+const broadcastColumns = `id, created_by, chat_id, text, status, cursor, sent, blocked, failed, created_at, finished_at`
+
+type BroadcastRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewBroadcastRepository(db *pgxpool.Pool) *BroadcastRepository {
+	return &BroadcastRepository{db: db}
+}
+
+// Create starts a broadcast of text, chatID is where the progress report goes
+func (r *BroadcastRepository) Create(ctx context.Context, createdBy, chatID int64, text string) (*models.Broadcast, error) {
+	bc := &models.Broadcast{}
+
+	query := `INSERT INTO broadcasts (created_by, chat_id, text) VALUES ($1, $2, $3)
+		RETURNING id, created_by, chat_id, text, status, cursor, created_at, finished_at`
+
+	err := r.db.QueryRow(ctx, query, createdBy, chatID, text).Scan(&bc.ID, &bc.CreatedBy, &bc.ChatID, &bc.Text, &bc.Status, &bc.Cursor, &bc.CreatedAt, &bc.FinishedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create broadcast: %w", err)
+	}
+
+	return bc, nil
+}
+
+func (r *BroadcastRepository) Get(ctx context.Context, id int64) (*models.Broadcast, error) {
+	query := `SELECT ` + broadcastColumns + ` FROM broadcasts WHERE id = $1`
+
+	bcs, err := r.query(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(bcs) == 0 {
+		return nil, fmt.Errorf("failed to get broadcast: %w", pgx.ErrNoRows)
+	}
+
+	return &bcs[0], nil
+}
+
+// Running returns the broadcasts that have not finished, e.g. interrupted by a restart
+func (r *BroadcastRepository) Running(ctx context.Context) ([]models.Broadcast, error) {
+	query := `SELECT ` + broadcastColumns + ` FROM broadcasts WHERE status = 'running' ORDER BY id`
+
+	return r.query(ctx, query)
+}
+
+// Recent returns the latest broadcasts, newest first
+func (r *BroadcastRepository) Recent(ctx context.Context, limit int) ([]models.Broadcast, error) {
+	query := `SELECT ` + broadcastColumns + ` FROM broadcasts ORDER BY id DESC LIMIT $1`
+
+	return r.query(ctx, query, limit)
+}
+
+func (r *BroadcastRepository) query(ctx context.Context, query string, args ...any) ([]models.Broadcast, error) {
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get broadcasts: %w", err)
+	}
+	defer rows.Close()
+
+	var bcs []models.Broadcast
+	for rows.Next() {
+		var bc models.Broadcast
+		err := rows.Scan(&bc.ID, &bc.CreatedBy, &bc.ChatID, &bc.Text, &bc.Status, &bc.Cursor, &bc.Sent, &bc.Blocked, &bc.Failed, &bc.CreatedAt, &bc.FinishedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan broadcast: %w", err)
+		}
+		bcs = append(bcs, bc)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read broadcasts: %w", err)
+	}
+
+	return bcs, nil
+}
+
+// Recipients returns up to limit active users after cursor, in id order, that the broadcast has not reached yet
+func (r *BroadcastRepository) Recipients(ctx context.Context, broadcastID, cursor int64, limit int) ([]int64, error) {
+	query := `SELECT u.id FROM users u
+		WHERE u.id > $2 AND u.is_active AND u.banned_at IS NULL AND NOT u.is_bot
+			AND NOT EXISTS (SELECT 1 FROM broadcast_deliveries d WHERE d.broadcast_id = $1 AND d.user_id = u.id)
+		ORDER BY u.id LIMIT $3`
+
+	rows, err := r.db.Query(ctx, query, broadcastID, cursor, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recipients: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan recipient: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read recipients: %w", err)
+	}
+
+	return ids, nil
+}
+
+// RecordDelivery stores the outcome for one recipient, counts it on the broadcast and moves the
+// cursor past it. Recipients that blocked the bot are marked inactive.
+func (r *BroadcastRepository) RecordDelivery(ctx context.Context, broadcastID, userID int64, status string, deliveryErr *string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// a recipient recorded again moves from its old counter to the new one
+	var previous string
+	err = tx.QueryRow(ctx, `SELECT status FROM broadcast_deliveries WHERE broadcast_id = $1 AND user_id = $2 FOR UPDATE`, broadcastID, userID).Scan(&previous)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("failed to get delivery: %w", err)
+	}
+
+	query := `INSERT INTO broadcast_deliveries (broadcast_id, user_id, status, error) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (broadcast_id, user_id) DO UPDATE SET status = EXCLUDED.status, error = EXCLUDED.error, attempted_at = CURRENT_TIMESTAMP`
+
+	if _, err := tx.Exec(ctx, query, broadcastID, userID, status, deliveryErr); err != nil {
+		return fmt.Errorf("failed to record delivery: %w", err)
+	}
+
+	counts := map[string]int{}
+	counts[status]++
+	if previous != "" {
+		counts[previous]--
+	}
+	query = `UPDATE broadcasts SET cursor = GREATEST(cursor, $2), sent = sent + $3, blocked = blocked + $4, failed = failed + $5
+		WHERE id = $1`
+	if _, err := tx.Exec(ctx, query, broadcastID, userID, counts[models.DeliverySent], counts[models.DeliveryBlocked], counts[models.DeliveryFailed]); err != nil {
+		return fmt.Errorf("failed to advance broadcast: %w", err)
+	}
+
+	if status == models.DeliveryBlocked {
+		if _, err := tx.Exec(ctx, `UPDATE users SET is_active = FALSE WHERE id = $1`, userID); err != nil {
+			return fmt.Errorf("failed to deactivate user: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit delivery: %w", err)
+	}
+
+	return nil
+}
+
+// Finish sets the final status of a running broadcast, false when it was not running anymore
+func (r *BroadcastRepository) Finish(ctx context.Context, id int64, status string) (bool, error) {
+	query := `UPDATE broadcasts SET status = $2, finished_at = CURRENT_TIMESTAMP WHERE id = $1 AND status = 'running'`
+
+	tag, err := r.db.Exec(ctx, query, id, status)
+	if err != nil {
+		return false, fmt.Errorf("failed to finish broadcast: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
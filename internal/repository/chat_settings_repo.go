@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nurashi/Newton/internal/models"
+)
+
+type ChatSettingsRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewChatSettingsRepository(db *pgxpool.Pool) *ChatSettingsRepository {
+	return &ChatSettingsRepository{db: db}
+}
+
+// Get returns the settings of a chat, defaults when none were saved
+func (r *ChatSettingsRepository) Get(ctx context.Context, chatID int64) (*models.ChatSettings, error) {
+	settings := &models.ChatSettings{ChatID: chatID}
+
+	query := `SELECT chat_id, disabled_commands, language, persona, updated_by, updated_at FROM chat_settings WHERE chat_id = $1`
+
+	err := r.db.QueryRow(ctx, query, chatID).Scan(&settings.ChatID, &settings.DisabledCommands, &settings.Language, &settings.Persona, &settings.UpdatedBy, &settings.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return settings, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat settings: %w", err)
+	}
+
+	return settings, nil
+}
+
+func (r *ChatSettingsRepository) Save(ctx context.Context, settings models.ChatSettings) error {
+	if settings.DisabledCommands == nil {
+		settings.DisabledCommands = []string{}
+	}
+
+	query := `INSERT INTO chat_settings (chat_id, disabled_commands, language, persona, updated_by, updated_at) VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)
+		ON CONFLICT (chat_id) DO UPDATE SET disabled_commands = EXCLUDED.disabled_commands, language = EXCLUDED.language,
+			persona = EXCLUDED.persona, updated_by = EXCLUDED.updated_by, updated_at = CURRENT_TIMESTAMP`
+
+	_, err := r.db.Exec(ctx, query, settings.ChatID, settings.DisabledCommands, settings.Language, settings.Persona, settings.UpdatedBy)
+	if err != nil {
+		return fmt.Errorf("failed to save chat settings: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nurashi/Newton/internal/models"
+)
+
+type ConversationRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewConversationRepository(db *pgxpool.Pool) *ConversationRepository {
+	return &ConversationRepository{db: db}
+}
+
+// GetOrCreateActive returns the chat's current conversation, starting a new one if it was cleared
+func (r *ConversationRepository) GetOrCreateActive(ctx context.Context, chatID int64) (*models.Conversation, error) {
+	conv := &models.Conversation{}
+
+	insert := `INSERT INTO conversations (chat_id) VALUES ($1) ON CONFLICT (chat_id) WHERE cleared_at IS NULL DO NOTHING`
+	if _, err := r.db.Exec(ctx, insert, chatID); err != nil {
+		return nil, fmt.Errorf("failed to create conversation: %w", err)
+	}
+
+	query := `SELECT id, chat_id, created_at, cleared_at FROM conversations WHERE chat_id = $1 AND cleared_at IS NULL`
+
+	err := r.db.QueryRow(ctx, query, chatID).Scan(&conv.ID, &conv.ChatID, &conv.CreatedAt, &conv.ClearedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active conversation: %w", err)
+	}
+
+	return conv, nil
+}
+
+// AddMessage appends a message to the chat's active conversation
+func (r *ConversationRepository) AddMessage(ctx context.Context, chatID, userID int64, role, content string) (*models.ConversationMessage, error) {
+	return r.AddImageMessage(ctx, chatID, userID, role, content, nil)
+}
+
+// AddImageMessage appends a message sent with a photo, imageFileID is nil for text only
+func (r *ConversationRepository) AddImageMessage(ctx context.Context, chatID, userID int64, role, content string, imageFileID *string) (*models.ConversationMessage, error) {
+	conv, err := r.GetOrCreateActive(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &models.ConversationMessage{}
+
+	query := `INSERT INTO messages (conversation_id, user_id, role, content, image_file_id) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, conversation_id, user_id, role, content, image_file_id, created_at`
+
+	err = r.db.QueryRow(ctx, query, conv.ID, userID, role, content, imageFileID).Scan(&msg.ID, &msg.ConversationID, &msg.UserID, &msg.Role, &msg.Content, &msg.ImageFileID, &msg.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add message: %w", err)
+	}
+
+	return msg, nil
+}
+
+// DeleteMessage removes a single message, used to roll back a prompt the AI failed to answer
+func (r *ConversationRepository) DeleteMessage(ctx context.Context, messageID int64) error {
+	query := `DELETE FROM messages WHERE id = $1`
+
+	_, err := r.db.Exec(ctx, query, messageID)
+	if err != nil {
+		return fmt.Errorf("failed to delete message: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateContent replaces the text of a message, used when an answer is regenerated
+func (r *ConversationRepository) UpdateContent(ctx context.Context, messageID int64, content string) error {
+	query := `UPDATE messages SET content = $2 WHERE id = $1`
+
+	_, err := r.db.Exec(ctx, query, messageID, content)
+	if err != nil {
+		return fmt.Errorf("failed to update message: %w", err)
+	}
+
+	return nil
+}
+
+// SetTelegramMessage records the Telegram message an answer was sent as
+func (r *ConversationRepository) SetTelegramMessage(ctx context.Context, messageID int64, telegramMessageID int) error {
+	query := `UPDATE messages SET telegram_message_id = $2 WHERE id = $1`
+
+	_, err := r.db.Exec(ctx, query, messageID, telegramMessageID)
+	if err != nil {
+		return fmt.Errorf("failed to set telegram message: %w", err)
+	}
+
+	return nil
+}
+
+// LastAnswer returns the answer sent as telegramMessageID while it is still the last message
+// of the chat's active conversation, nil otherwise
+func (r *ConversationRepository) LastAnswer(ctx context.Context, chatID int64, telegramMessageID int) (*models.ConversationMessage, error) {
+	query := `
+		SELECT m.id, m.conversation_id, m.user_id, m.role, m.content, m.created_at
+		FROM messages m
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE c.chat_id = $1 AND c.cleared_at IS NULL AND m.telegram_message_id = $2 AND m.role = 'assistant'
+			AND m.id = (SELECT MAX(id) FROM messages WHERE conversation_id = c.id)`
+
+	msg := &models.ConversationMessage{}
+	err := r.db.QueryRow(ctx, query, chatID, telegramMessageID).Scan(&msg.ID, &msg.ConversationID, &msg.UserID, &msg.Role, &msg.Content, &msg.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last answer: %w", err)
+	}
+
+	return msg, nil
+}
+
+// RecentMessages returns the last limit messages of the active conversation, oldest first
+func (r *ConversationRepository) RecentMessages(ctx context.Context, chatID int64, limit int) ([]models.ConversationMessage, error) {
+	query := `
+		SELECT id, conversation_id, user_id, first_name, role, content, image_file_id, created_at FROM (
+			SELECT m.id, m.conversation_id, m.user_id, u.first_name, m.role, m.content, m.image_file_id, m.created_at
+			FROM messages m
+			JOIN conversations c ON c.id = m.conversation_id
+			LEFT JOIN users u ON u.id = m.user_id
+			WHERE c.chat_id = $1 AND c.cleared_at IS NULL
+			ORDER BY m.id DESC
+			LIMIT $2
+		) recent
+		ORDER BY id ASC`
+
+	rows, err := r.db.Query(ctx, query, chatID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recent messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []models.ConversationMessage
+	for rows.Next() {
+		var msg models.ConversationMessage
+		if err := rows.Scan(&msg.ID, &msg.ConversationID, &msg.UserID, &msg.AuthorName, &msg.Role, &msg.Content, &msg.ImageFileID, &msg.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read messages: %w", err)
+	}
+
+	return messages, nil
+}
+
+// CountMessages returns how many messages the active conversation holds
+func (r *ConversationRepository) CountMessages(ctx context.Context, chatID int64) (int, error) {
+	var count int
+
+	query := `
+		SELECT COUNT(m.id) FROM messages m
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE c.chat_id = $1 AND c.cleared_at IS NULL`
+
+	if err := r.db.QueryRow(ctx, query, chatID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count messages: %w", err)
+	}
+
+	return count, nil
+}
+
+// Clear closes the active conversation, the next message starts a fresh one
+func (r *ConversationRepository) Clear(ctx context.Context, chatID int64) error {
+	query := `UPDATE conversations SET cleared_at = CURRENT_TIMESTAMP WHERE chat_id = $1 AND cleared_at IS NULL`
+
+	_, err := r.db.Exec(ctx, query, chatID)
+	if err != nil {
+		return fmt.Errorf("failed to clear conversation: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nurashi/Newton/internal/models"
+)
+
+type DocumentRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewDocumentRepository(db *pgxpool.Pool) *DocumentRepository {
+	return &DocumentRepository{db: db}
+}
+
+// Create stores a document together with its chunks in one transaction
+func (r *DocumentRepository) Create(ctx context.Context, doc models.Document, chunks []models.DocumentChunk) (*models.Document, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	created := &models.Document{}
+
+	query := `INSERT INTO documents (chat_id, user_id, filename, file_type, char_count, file_id, content) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, chat_id, user_id, filename, file_type, char_count, file_id, created_at`
+
+	err = tx.QueryRow(ctx, query, doc.ChatID, doc.UserID, doc.Filename, doc.FileType, doc.CharCount, doc.FileID, doc.Content).Scan(&created.ID, &created.ChatID, &created.UserID, &created.Filename, &created.FileType, &created.CharCount, &created.FileID, &created.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create document: %w", err)
+	}
+
+	batch := &pgx.Batch{}
+	for _, c := range chunks {
+		batch.Queue(`INSERT INTO document_chunks (document_id, chunk_index, location, content, embedding, embedding_model) VALUES ($1, $2, $3, $4, $5, $6)`,
+			created.ID, c.ChunkIndex, c.Location, c.Content, c.Embedding, c.EmbeddingModel)
+	}
+
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return nil, fmt.Errorf("failed to store document chunks: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit document: %w", err)
+	}
+
+	created.ChunkCount = len(chunks)
+	created.Embedded = len(chunks) > 0 && chunks[0].EmbeddingModel != nil
+	return created, nil
+}
+
+// documentColumns are selected from documents d in the order documentFields scans them
+const documentColumns = `d.id, d.chat_id, d.user_id, d.filename, d.file_type, d.char_count, d.file_id, d.created_at,
+	(SELECT COUNT(*) FROM document_chunks c WHERE c.document_id = d.id),
+	EXISTS (SELECT 1 FROM document_chunks c WHERE c.document_id = d.id AND c.embedding_model IS NOT NULL)`
+
+func documentFields(d *models.Document) []any {
+	return []any{&d.ID, &d.ChatID, &d.UserID, &d.Filename, &d.FileType, &d.CharCount, &d.FileID, &d.CreatedAt, &d.ChunkCount, &d.Embedded}
+}
+
+// GetByID returns a document without its content, nil when it doesn't exist
+func (r *DocumentRepository) GetByID(ctx context.Context, id int64) (*models.Document, error) {
+	doc := &models.Document{}
+
+	err := r.db.QueryRow(ctx, `SELECT `+documentColumns+` FROM documents d WHERE d.id = $1`, id).Scan(documentFields(doc)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document: %w", err)
+	}
+
+	return doc, nil
+}
+
+// ListByUser returns the newest documents of a user's library, newest first
+func (r *DocumentRepository) ListByUser(ctx context.Context, userID int64, limit int) ([]models.Document, error) {
+	rows, err := r.db.Query(ctx, `SELECT `+documentColumns+` FROM documents d WHERE d.user_id = $1 ORDER BY d.created_at DESC, d.id DESC LIMIT $2`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+	defer rows.Close()
+
+	var docs []models.Document
+	for rows.Next() {
+		var d models.Document
+		if err := rows.Scan(documentFields(&d)...); err != nil {
+			return nil, fmt.Errorf("failed to scan document: %w", err)
+		}
+		docs = append(docs, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read documents: %w", err)
+	}
+
+	return docs, nil
+}
+
+// Content returns the extracted text of a document, empty for documents stored before texts were kept
+func (r *DocumentRepository) Content(ctx context.Context, id int64) (string, error) {
+	var content *string
+	if err := r.db.QueryRow(ctx, `SELECT content FROM documents WHERE id = $1`, id).Scan(&content); err != nil {
+		return "", fmt.Errorf("failed to get document content: %w", err)
+	}
+	if content == nil {
+		return "", nil
+	}
+	return *content, nil
+}
+
+// Usage returns how many documents a user stores and their total size in characters
+func (r *DocumentRepository) Usage(ctx context.Context, userID int64) (int, int64, error) {
+	var count int
+	var chars int64
+
+	err := r.db.QueryRow(ctx, `SELECT COUNT(*), COALESCE(SUM(char_count), 0) FROM documents WHERE user_id = $1`, userID).Scan(&count, &chars)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get document usage: %w", err)
+	}
+
+	return count, chars, nil
+}
+
+// Delete removes a document of a user with its chunks, it stops being active in every chat;
+// false when the user has no such document
+func (r *DocumentRepository) Delete(ctx context.Context, id, userID int64) (bool, error) {
+	tag, err := r.db.Exec(ctx, `DELETE FROM documents WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete document: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// SetActive makes a document the one a chat's questions are answered from
+func (r *DocumentRepository) SetActive(ctx context.Context, chatID, documentID int64) error {
+	query := `INSERT INTO chat_active_documents (chat_id, document_id) VALUES ($1, $2)
+		ON CONFLICT (chat_id) DO UPDATE SET document_id = EXCLUDED.document_id, updated_at = CURRENT_TIMESTAMP`
+
+	if _, err := r.db.Exec(ctx, query, chatID, documentID); err != nil {
+		return fmt.Errorf("failed to set active document: %w", err)
+	}
+
+	return nil
+}
+
+// Active returns the active document of a chat without its content, nil when there is none
+func (r *DocumentRepository) Active(ctx context.Context, chatID int64) (*models.Document, error) {
+	doc := &models.Document{}
+
+	query := `SELECT ` + documentColumns + ` FROM chat_active_documents a JOIN documents d ON d.id = a.document_id WHERE a.chat_id = $1`
+
+	err := r.db.QueryRow(ctx, query, chatID).Scan(documentFields(doc)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active document: %w", err)
+	}
+
+	return doc, nil
+}
+
+// ClearActive stops answering a chat's questions from a document
+func (r *DocumentRepository) ClearActive(ctx context.Context, chatID int64) error {
+	if _, err := r.db.Exec(ctx, `DELETE FROM chat_active_documents WHERE chat_id = $1`, chatID); err != nil {
+		return fmt.Errorf("failed to clear active document: %w", err)
+	}
+
+	return nil
+}
+
+// Chunks returns every chunk of a document in document order
+func (r *DocumentRepository) Chunks(ctx context.Context, documentID int64) ([]models.DocumentChunk, error) {
+	query := `SELECT id, document_id, chunk_index, location, content, embedding, embedding_model
+		FROM document_chunks WHERE document_id = $1 ORDER BY chunk_index`
+
+	rows, err := r.db.Query(ctx, query, documentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document chunks: %w", err)
+	}
+	defer rows.Close()
+
+	var chunks []models.DocumentChunk
+	for rows.Next() {
+		var c models.DocumentChunk
+		if err := rows.Scan(&c.ID, &c.DocumentID, &c.ChunkIndex, &c.Location, &c.Content, &c.Embedding, &c.EmbeddingModel); err != nil {
+			return nil, fmt.Errorf("failed to scan document chunk: %w", err)
+		}
+		chunks = append(chunks, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read document chunks: %w", err)
+	}
+
+	return chunks, nil
+}
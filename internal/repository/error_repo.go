@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nurashi/Newton/internal/models"
+)
+
+type ErrorRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewErrorRepository(db *pgxpool.Pool) *ErrorRepository {
+	return &ErrorRepository{db: db}
+}
+
+func (r *ErrorRepository) Create(ctx context.Context, event models.ErrorEvent) error {
+	query := `INSERT INTO error_events (id, chat_id, user_id, update_type, command, message, stack) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	_, err := r.db.Exec(ctx, query, event.ID, event.ChatID, event.UserID, event.UpdateType, event.Command, event.Message, event.Stack)
+	if err != nil {
+		return fmt.Errorf("failed to store error event: %w", err)
+	}
+
+	return nil
+}
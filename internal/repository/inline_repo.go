@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nurashi/Newton/internal/models"
+)
+
+type InlineRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewInlineRepository(db *pgxpool.Pool) *InlineRepository {
+	return &InlineRepository{db: db}
+}
+
+func (r *InlineRepository) RecordChoice(ctx context.Context, choice models.InlineChoice) error {
+	query := `INSERT INTO inline_choices (user_id, result_id, kind, query) VALUES ($1, $2, $3, $4)`
+
+	_, err := r.db.Exec(ctx, query, choice.UserID, choice.ResultID, choice.Kind, choice.Query)
+	if err != nil {
+		return fmt.Errorf("failed to record inline choice: %w", err)
+	}
+
+	return nil
+}
+
+// CountByKind returns how many inline results of each kind were sent, userID 0 counts everyone
+func (r *InlineRepository) CountByKind(ctx context.Context, userID int64) (map[string]int64, error) {
+	query := `SELECT kind, COUNT(*) FROM inline_choices WHERE $1 = 0 OR user_id = $1 GROUP BY kind`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count inline choices: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var kind string
+		var n int64
+		if err := rows.Scan(&kind, &n); err != nil {
+			return nil, fmt.Errorf("failed to scan inline choices: %w", err)
+		}
+		counts[kind] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read inline choices: %w", err)
+	}
+
+	return counts, nil
+}
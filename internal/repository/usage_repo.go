@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nurashi/Newton/internal/models"
+)
+
+type UsageRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewUsageRepository(db *pgxpool.Pool) *UsageRepository {
+	return &UsageRepository{db: db}
+}
+
+// Add records one AI request and its tokens on the user's row for the UTC day of at
+func (r *UsageRepository) Add(ctx context.Context, userID int64, at time.Time, promptTokens, completionTokens, totalTokens int) error {
+	query := `INSERT INTO ai_usage (user_id, day, requests, prompt_tokens, completion_tokens, total_tokens) VALUES ($1, $2, 1, $3, $4, $5)
+		ON CONFLICT (user_id, day) DO UPDATE SET
+			requests = ai_usage.requests + 1,
+			prompt_tokens = ai_usage.prompt_tokens + EXCLUDED.prompt_tokens,
+			completion_tokens = ai_usage.completion_tokens + EXCLUDED.completion_tokens,
+			total_tokens = ai_usage.total_tokens + EXCLUDED.total_tokens`
+
+	_, err := r.db.Exec(ctx, query, userID, day(at), promptTokens, completionTokens, totalTokens)
+	if err != nil {
+		return fmt.Errorf("failed to record usage: %w", err)
+	}
+
+	return nil
+}
+
+// Totals returns the tokens a user spent on the UTC day and month of at
+func (r *UsageRepository) Totals(ctx context.Context, userID int64, at time.Time) (models.UsageTotals, error) {
+	var totals models.UsageTotals
+
+	query := `SELECT COALESCE(SUM(total_tokens) FILTER (WHERE day = $2), 0), COALESCE(SUM(total_tokens), 0)
+		FROM ai_usage WHERE user_id = $1 AND day >= date_trunc('month', $2::date)`
+
+	err := r.db.QueryRow(ctx, query, userID, day(at)).Scan(&totals.Day, &totals.Month)
+	if err != nil {
+		return totals, fmt.Errorf("failed to get usage: %w", err)
+	}
+
+	return totals, nil
+}
+
+// day is the UTC calendar date usage is accounted to
+func day(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
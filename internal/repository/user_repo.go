@@ -8,6 +8,13 @@ import (
 	"github.com/nurashi/Newton/internal/models"
 )
 
+// userColumns are selected in the order userFields scans them
+const userColumns = `id, username, first_name, last_name, is_bot, language_code, message_count, role, banned_at, daily_tokens, voice_replies, created_at, updated_at, last_seen`
+
+func userFields(u *models.User) []any {
+	return []any{&u.ID, &u.Username, &u.FirstName, &u.LastName, &u.IsBot, &u.LanguageCode, &u.MessageCount, &u.Role, &u.BannedAt, &u.DailyTokens, &u.VoiceReplies, &u.CreatedAt, &u.UpdatedAt, &u.LastSeen}
+}
+
 type UserRepository struct {
 	db *pgxpool.Pool
 }
@@ -25,10 +32,11 @@ func (r *UserRepository) CreateOrUpdate(ctx context.Context, telegramUser models
 			is_bot = EXCLUDED.is_bot,
 			language_code = EXCLUDED.language_code,
 			updated_at = CURRENT_TIMESTAMP,
-			last_seen = CURRENT_TIMESTAMP
-		RETURNING id, username, first_name, last_name, is_bot, language_code, message_count, created_at, updated_at, last_seen`
+			last_seen = CURRENT_TIMESTAMP,
+			is_active = TRUE
+		RETURNING ` + userColumns
 
-	err := r.db.QueryRow(ctx, query, telegramUser.ID, telegramUser.Username, telegramUser.FirstName, telegramUser.LastName, telegramUser.IsBot, telegramUser.LanguageCode).Scan(&user.ID, &user.Username, &user.FirstName, &user.LastName, &user.IsBot, &user.LanguageCode, &user.MessageCount, &user.CreatedAt, &user.UpdatedAt, &user.LastSeen)
+	err := r.db.QueryRow(ctx, query, telegramUser.ID, telegramUser.Username, telegramUser.FirstName, telegramUser.LastName, telegramUser.IsBot, telegramUser.LanguageCode).Scan(userFields(user)...)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to create or update user: %w", err)
@@ -40,13 +48,9 @@ func (r *UserRepository) CreateOrUpdate(ctx context.Context, telegramUser models
 func (r *UserRepository) GetByID(ctx context.Context, userID int64) (*models.User, error) {
 	user := &models.User{}
 
-	query := `SELECT id, username, first_name, last_name, is_bot, language_code, message_count, created_at, updated_at, last_seen FROM users WHERE id = $1`
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
 
-	err := r.db.QueryRow(ctx, query, userID).Scan(&user.ID, &user.Username, &user.FirstName, &user.LastName, &user.IsBot, &user.LanguageCode, &user.MessageCount,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-		&user.LastSeen,
-	)
+	err := r.db.QueryRow(ctx, query, userID).Scan(userFields(user)...)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
@@ -78,19 +82,126 @@ func (r *UserRepository) IncrementMessageCount(ctx context.Context, userID int64
 	return nil
 }
 
-func (r *UserRepository) GetStats(ctx context.Context, userID int64) (map[string]interface{}, error) {
-	user, err := r.GetByID(ctx, userID)
+// SetBanned bans or unbans a user, false when the user does not exist
+func (r *UserRepository) SetBanned(ctx context.Context, userID int64, banned bool) (bool, error) {
+	query := `UPDATE users SET banned_at = CASE WHEN $2 THEN COALESCE(banned_at, CURRENT_TIMESTAMP) END WHERE id = $1`
+
+	tag, err := r.db.Exec(ctx, query, userID, banned)
+	if err != nil {
+		return false, fmt.Errorf("failed to update ban: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// SetRole grants or revokes a role, false when the user does not exist
+func (r *UserRepository) SetRole(ctx context.Context, userID int64, role string) (bool, error) {
+	query := `UPDATE users SET role = $2 WHERE id = $1`
+
+	tag, err := r.db.Exec(ctx, query, userID, role)
+	if err != nil {
+		return false, fmt.Errorf("failed to update role: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// IDsWithRole lists the users that hold role
+func (r *UserRepository) IDsWithRole(ctx context.Context, role string) ([]int64, error) {
+	rows, err := r.db.Query(ctx, `SELECT id FROM users WHERE role = $1 ORDER BY id`, role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users by role: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan user id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read users by role: %w", err)
+	}
+
+	return ids, nil
+}
+
+// SetDailyTokens overrides a user's daily AI token limit, nil restores the default
+func (r *UserRepository) SetDailyTokens(ctx context.Context, userID int64, tokens *int64) (bool, error) {
+	query := `UPDATE users SET daily_tokens = $2 WHERE id = $1`
+
+	tag, err := r.db.Exec(ctx, query, userID, tokens)
 	if err != nil {
-		return nil, err
+		return false, fmt.Errorf("failed to update daily tokens: %w", err)
 	}
 
-	stats := map[string]interface{}{
-		"user_id":       user.ID,
-		"username":      user.Username,
-		"first_name":    user.FirstName,
-		"message_count": user.MessageCount,
-		"member_since":  user.CreatedAt.Format("2006-01-02"),
-		"last_seen":     user.LastSeen.Format("2006-01-02 15:04:05"),
+	return tag.RowsAffected() > 0, nil
+}
+
+// SetVoiceReplies turns spoken answers to voice messages on or off
+func (r *UserRepository) SetVoiceReplies(ctx context.Context, userID int64, enabled bool) error {
+	query := `UPDATE users SET voice_replies = $2 WHERE id = $1`
+
+	_, err := r.db.Exec(ctx, query, userID, enabled)
+	if err != nil {
+		return fmt.Errorf("failed to update voice replies: %w", err)
+	}
+
+	return nil
+}
+
+// Stats aggregates message activity over all users
+func (r *UserRepository) Stats(ctx context.Context) (*models.UserStats, error) {
+	stats := &models.UserStats{}
+
+	query := `SELECT COUNT(*), COALESCE(SUM(message_count), 0), COALESCE(AVG(message_count), 0), COALESCE(MAX(message_count), 0),
+			COUNT(*) FILTER (WHERE message_count = 0), COUNT(*) FILTER (WHERE banned_at IS NOT NULL)
+		FROM users`
+
+	err := r.db.QueryRow(ctx, query).Scan(&stats.TotalUsers, &stats.TotalMessages, &stats.AvgMessages, &stats.MaxMessages, &stats.SilentUsers, &stats.BannedUsers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user totals: %w", err)
+	}
+
+	rows, err := r.db.Query(ctx, `SELECT `+userColumns+` FROM users WHERE message_count > 0 ORDER BY message_count DESC LIMIT 5`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get top users: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(userFields(&u)...); err != nil {
+			return nil, fmt.Errorf("failed to scan top user: %w", err)
+		}
+		stats.TopUsers = append(stats.TopUsers, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read top users: %w", err)
+	}
+
+	query = `SELECT DATE(created_at), COUNT(*), COALESCE(SUM(message_count), 0) FROM users
+		GROUP BY DATE(created_at) ORDER BY DATE(created_at) DESC LIMIT 10`
+
+	rows, err = r.db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get signups: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d models.SignupDay
+		if err := rows.Scan(&d.Date, &d.NewUsers, &d.Messages); err != nil {
+			return nil, fmt.Errorf("failed to scan signups: %w", err)
+		}
+		stats.RecentSignups = append(stats.RecentSignups, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read signups: %w", err)
 	}
 
 	return stats, nil
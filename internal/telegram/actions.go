@@ -0,0 +1,160 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nurashi/Newton/internal/ai"
+)
+
+// answerActionPrefix marks the callback data of the buttons under AI answers
+const answerActionPrefix = "answer:"
+
+const (
+	actionRegenerate = "regenerate"
+	actionContinue   = "continue"
+	actionShorter    = "shorter"
+	actionSimpler    = "simpler"
+	actionTranslate  = "translate"
+)
+
+// answerActions are the buttons under an AI answer, prompt is the follow-up asked for it
+var answerActions = []struct {
+	name, label, prompt string
+}{
+	{actionRegenerate, "🔄 Regenerate", ""},
+	{actionContinue, "➡️ Continue", "Continue your previous answer from where it stopped."},
+	{actionShorter, "✂️ Make shorter", "Make your previous answer shorter, keep only the essentials."},
+	{actionSimpler, "💡 Explain simpler", "Explain your previous answer in simpler words, as if to a beginner."},
+	{actionTranslate, "🌐 Translate", "Translate your previous answer into %s."},
+}
+
+func answerKeyboard() tgbotapi.InlineKeyboardMarkup {
+	button := func(i int) tgbotapi.InlineKeyboardButton {
+		return tgbotapi.NewInlineKeyboardButtonData(answerActions[i].label, answerActionPrefix+answerActions[i].name)
+	}
+
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(button(0), button(1)),
+		tgbotapi.NewInlineKeyboardRow(button(2), button(3)),
+		tgbotapi.NewInlineKeyboardRow(button(4)),
+	)
+}
+
+// attachActions adds the answer buttons to the message an answer was sent as and remembers it
+func (b *Bot) attachActions(ctx context.Context, chatID int64, telegramMessageID int, answerID int64) {
+	edit := tgbotapi.NewEditMessageReplyMarkup(chatID, telegramMessageID, answerKeyboard())
+	if _, err := b.api.Request(edit); err != nil {
+		slog.Debug("failed to attach answer actions", "chat_id", chatID, "error", err)
+		return
+	}
+
+	if err := b.convRepo.SetTelegramMessage(ctx, answerID, telegramMessageID); err != nil {
+		slog.Error("failed to map answer to message", "chat_id", chatID, "message_id", answerID, "error", err)
+	}
+}
+
+// removeActions takes the answer buttons off a message
+func (b *Bot) removeActions(chatID int64, telegramMessageID int) {
+	markup := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}
+	if _, err := b.api.Request(tgbotapi.NewEditMessageReplyMarkup(chatID, telegramMessageID, markup)); err != nil {
+		slog.Debug("failed to remove answer actions", "chat_id", chatID, "error", err)
+	}
+}
+
+// answerCallback acknowledges a button press, text is shown as a short notification
+func (b *Bot) answerCallback(queryID, text string) {
+	if _, err := b.api.Request(tgbotapi.NewCallback(queryID, text)); err != nil {
+		slog.Debug("failed to answer callback", "error", err)
+	}
+}
+
+// handleCallbackQuery runs the button pressed under an AI answer, only the latest answer of a chat can be changed
+func (b *Bot) handleCallbackQuery(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	name, ok := strings.CutPrefix(query.Data, answerActionPrefix)
+	if !ok || query.Message == nil {
+		b.answerCallback(query.ID, "")
+		return
+	}
+
+	message := query.Message
+	chatID, userID := message.Chat.ID, query.From.ID
+
+	ctx, ok = b.identify(ctx, query.From, chatID)
+	if !ok {
+		b.answerCallback(query.ID, "")
+		return
+	}
+
+	ctx, meter := ai.WithMeter(ctx)
+	defer b.recordUsage(ctx, userID, meter)
+
+	last, err := b.convRepo.LastAnswer(ctx, chatID, message.MessageID)
+	if err != nil {
+		slog.Error("failed to find answer", "chat_id", chatID, "message_id", message.MessageID, "error", err)
+		b.answerCallback(query.ID, "Sorry, something went wrong. Please try again later.")
+		return
+	}
+	if last == nil {
+		b.answerCallback(query.ID, "Only the latest answer can be changed.")
+		b.removeActions(chatID, message.MessageID)
+		return
+	}
+
+	if refusal := b.aiRefusal(ctx, chatID, userID); refusal != "" {
+		b.answerCallback(query.ID, refusal)
+		return
+	}
+
+	turn := aiTurn{chatID: chatID, userID: userID, group: isGroup(message.Chat), replyTo: replyTarget(message)}
+	for _, action := range answerActions {
+		if action.name != name {
+			continue
+		}
+
+		switch name {
+		case actionRegenerate:
+			turn.regenerate = last
+		case actionTranslate:
+			target, err := b.translationTarget(ctx, chatID)
+			if err != nil {
+				slog.Error("failed to load chat settings", "chat_id", chatID, "error", err)
+				b.answerCallback(query.ID, settingsUnavailable)
+				return
+			}
+			turn.prompt = fmt.Sprintf(action.prompt, target)
+		default:
+			turn.prompt = action.prompt
+		}
+
+		slog.Info("answer action", "chat_id", chatID, "user_id", userID, "action", name)
+		b.answerCallback(query.ID, action.label)
+		b.removeActions(chatID, message.MessageID)
+
+		if !b.answer(ctx, turn) {
+			// the answer is still the last one, it keeps its buttons for another try
+			b.attachActions(ctx, chatID, message.MessageID, last.ID)
+		}
+		return
+	}
+
+	b.answerCallback(query.ID, "")
+}
+
+// translationTarget is the chat's configured language, else the user's Telegram language, else English
+func (b *Bot) translationTarget(ctx context.Context, chatID int64) (string, error) {
+	settings, err := b.chatSettings(ctx, chatID)
+	if err != nil {
+		return "", err
+	}
+	if settings.Language != nil {
+		return *settings.Language, nil
+	}
+	if user := userFrom(ctx); user != nil && user.LanguageCode != nil && !strings.HasPrefix(*user.LanguageCode, "en") {
+		return fmt.Sprintf("the language with the code %q", *user.LanguageCode), nil
+	}
+	return "English", nil
+}
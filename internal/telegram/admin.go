@@ -0,0 +1,328 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nurashi/Newton/internal/models"
+)
+
+const adminUsage = `Admin commands:
+/admin stats - user and message aggregates
+/admin user <id> - profile, role and AI usage of a user
+/admin ban <id>, /admin unban <id> - ignore or restore a user
+/admin quota <id> <tokens|default> - set a user's daily AI token limit, 0 for none
+/admin role <id> <admin|user> - grant or revoke the admin role
+/admin broadcast <text> - send a message to every active user
+/admin broadcasts - progress of recent broadcasts
+/admin cancel <id> - stop a running broadcast`
+
+// handleAdminCommand runs an /admin subcommand, the router lets only admins through
+func (b *Bot) handleAdminCommand(ctx context.Context, message *tgbotapi.Message, args string) {
+	chatID := message.Chat.ID
+	sub, rest, _ := strings.Cut(strings.TrimSpace(args), " ")
+	rest = strings.TrimSpace(rest)
+
+	slog.Info("admin command", "chat_id", chatID, "user_id", message.From.ID, "command", "admin "+sub)
+
+	switch strings.ToLower(sub) {
+	case "stats":
+		b.adminStats(ctx, chatID)
+	case "user":
+		b.adminUser(ctx, chatID, rest)
+	case "ban":
+		b.adminBan(ctx, chatID, rest, true)
+	case "unban":
+		b.adminBan(ctx, chatID, rest, false)
+	case "quota":
+		b.adminQuota(ctx, chatID, rest)
+	case "role":
+		b.adminRole(ctx, chatID, rest)
+	case "broadcast":
+		b.adminBroadcast(ctx, message, rest)
+	case "broadcasts":
+		b.adminBroadcasts(ctx, chatID)
+	case "cancel":
+		b.adminCancelBroadcast(ctx, chatID, rest)
+	default:
+		b.sendText(chatID, adminUsage)
+	}
+}
+
+func (b *Bot) adminStats(ctx context.Context, chatID int64) {
+	stats, err := b.userRepo.Stats(ctx)
+	if err != nil {
+		slog.Error("failed to get admin stats", "chat_id", chatID, "error", err)
+		b.sendText(chatID, "Failed to load statistics.")
+		return
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Users: %d (%d without messages, %d banned)\n", stats.TotalUsers, stats.SilentUsers, stats.BannedUsers)
+	fmt.Fprintf(&sb, "Messages: %d total, %.1f avg per user, %d max\n", stats.TotalMessages, stats.AvgMessages, stats.MaxMessages)
+
+	if inline, err := b.inlineRepo.CountByKind(ctx, 0); err != nil {
+		slog.Error("failed to count inline choices", "chat_id", chatID, "error", err)
+	} else {
+		fmt.Fprintf(&sb, "Inline results sent: %d AI, %d weather, %d photo\n", inline[models.InlineAI], inline[models.InlineWeather], inline[models.InlinePhoto])
+	}
+
+	if len(stats.TopUsers) > 0 {
+		sb.WriteString("\nTop users:\n")
+		for i, u := range stats.TopUsers {
+			fmt.Fprintf(&sb, "%d. %s (@%s, %d) - %d messages\n", i+1, u.FirstName, b.stringPtrToString(u.Username), u.ID, u.MessageCount)
+		}
+	}
+
+	if len(stats.RecentSignups) > 0 {
+		sb.WriteString("\nNew users by day:\n")
+		for _, d := range stats.RecentSignups {
+			fmt.Fprintf(&sb, "%s: %d new, %d messages since\n", d.Date.Format("2006-01-02"), d.NewUsers, d.Messages)
+		}
+	}
+
+	b.sendText(chatID, sb.String())
+}
+
+func (b *Bot) adminUser(ctx context.Context, chatID int64, args string) {
+	userID, ok := b.parseUserID(chatID, args)
+	if !ok {
+		return
+	}
+
+	user, err := b.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		b.sendText(chatID, fmt.Sprintf("User %d not found.", userID))
+		return
+	}
+
+	banned := "no"
+	if user.BannedAt != nil {
+		banned = "since " + user.BannedAt.Format("2006-01-02 15:04")
+	}
+
+	dailyLimit := "default"
+	if user.DailyTokens != nil {
+		dailyLimit = strconv.FormatInt(*user.DailyTokens, 10)
+	}
+
+	usage := "unavailable"
+	if totals, err := b.usageRepo.Totals(ctx, userID, time.Now()); err == nil {
+		usage = fmt.Sprintf("%d tokens today, %d this month", totals.Day, totals.Month)
+	}
+
+	b.sendText(chatID, fmt.Sprintf(`User %d
+
+Name: %s %s
+Username: @%s
+Role: %s
+Banned: %s
+Messages: %d
+AI usage: %s
+Daily token limit: %s
+Member since: %s
+Last seen: %s`,
+		user.ID,
+		user.FirstName, b.stringPtrToString(user.LastName),
+		b.stringPtrToString(user.Username),
+		user.Role,
+		banned,
+		user.MessageCount,
+		usage,
+		dailyLimit,
+		user.CreatedAt.Format("2006-01-02"),
+		user.LastSeen.Format("2006-01-02 15:04:05")))
+}
+
+func (b *Bot) adminBan(ctx context.Context, chatID int64, args string, ban bool) {
+	userID, ok := b.parseUserID(chatID, args)
+	if !ok {
+		return
+	}
+
+	if ban {
+		target, err := b.userRepo.GetByID(ctx, userID)
+		if err != nil {
+			b.sendText(chatID, fmt.Sprintf("User %d not found.", userID))
+			return
+		}
+		if b.isAdminUser(target) {
+			b.sendText(chatID, "Admins can't be banned.")
+			return
+		}
+	}
+
+	found, err := b.userRepo.SetBanned(ctx, userID, ban)
+	if err != nil {
+		slog.Error("failed to update ban", "user_id", userID, "error", err)
+		b.sendText(chatID, "Failed to update the user.")
+		return
+	}
+	if !found {
+		b.sendText(chatID, fmt.Sprintf("User %d not found.", userID))
+		return
+	}
+
+	if ban {
+		b.sendText(chatID, fmt.Sprintf("User %d is banned.", userID))
+	} else {
+		b.sendText(chatID, fmt.Sprintf("User %d is unbanned.", userID))
+	}
+}
+
+func (b *Bot) adminQuota(ctx context.Context, chatID int64, args string) {
+	idArg, limitArg, _ := strings.Cut(args, " ")
+	userID, ok := b.parseUserID(chatID, idArg)
+	if !ok {
+		return
+	}
+
+	var tokens *int64
+	limitArg = strings.TrimSpace(limitArg)
+	if limitArg != "default" {
+		n, err := strconv.ParseInt(limitArg, 10, 64)
+		if err != nil || n < 0 {
+			b.sendText(chatID, "Usage: /admin quota <id> <tokens|default>")
+			return
+		}
+		tokens = &n
+	}
+
+	found, err := b.userRepo.SetDailyTokens(ctx, userID, tokens)
+	if err != nil {
+		slog.Error("failed to update quota", "user_id", userID, "error", err)
+		b.sendText(chatID, "Failed to update the user.")
+		return
+	}
+	if !found {
+		b.sendText(chatID, fmt.Sprintf("User %d not found.", userID))
+		return
+	}
+
+	switch {
+	case tokens == nil:
+		b.sendText(chatID, fmt.Sprintf("User %d uses the default daily limit of %d tokens again.", userID, b.limits.DailyTokens))
+	case *tokens == 0:
+		b.sendText(chatID, fmt.Sprintf("User %d has no daily limit now.", userID))
+	default:
+		b.sendText(chatID, fmt.Sprintf("User %d may now use %d tokens a day.", userID, *tokens))
+	}
+}
+
+// adminRole grants or revokes the admin role and updates the user's command menu to match
+func (b *Bot) adminRole(ctx context.Context, chatID int64, args string) {
+	idArg, role, _ := strings.Cut(args, " ")
+	userID, ok := b.parseUserID(chatID, idArg)
+	if !ok {
+		return
+	}
+
+	role = strings.ToLower(strings.TrimSpace(role))
+	if role != models.RoleAdmin && role != models.RoleUser {
+		b.sendText(chatID, "Usage: /admin role <id> <admin|user>")
+		return
+	}
+	if role == models.RoleUser && slices.Contains(b.cfg.AdminIDs, userID) {
+		b.sendText(chatID, fmt.Sprintf("User %d is an admin by configuration, remove them from TELEGRAM_ADMIN_IDS instead.", userID))
+		return
+	}
+
+	found, err := b.userRepo.SetRole(ctx, userID, role)
+	if err != nil {
+		slog.Error("failed to update role", "user_id", userID, "error", err)
+		b.sendText(chatID, "Failed to update the user.")
+		return
+	}
+	if !found {
+		b.sendText(chatID, fmt.Sprintf("User %d not found.", userID))
+		return
+	}
+
+	b.publishUserCommands(userID, role)
+	slog.Info("role changed", "user_id", userID, "role", role)
+	b.sendText(chatID, fmt.Sprintf("User %d is now %s.", userID, map[string]string{models.RoleAdmin: "an admin", models.RoleUser: "a regular user"}[role]))
+}
+
+// adminBroadcast starts a background job sending text to every active user
+func (b *Bot) adminBroadcast(ctx context.Context, message *tgbotapi.Message, text string) {
+	chatID := message.Chat.ID
+	if text == "" {
+		b.sendText(chatID, "Usage: /admin broadcast <text>")
+		return
+	}
+
+	bc, err := b.broadcastRepo.Create(ctx, message.From.ID, chatID, text)
+	if err != nil {
+		slog.Error("failed to create broadcast", "chat_id", chatID, "error", err)
+		b.sendText(chatID, "Failed to start the broadcast.")
+		return
+	}
+
+	b.startBroadcast(*bc)
+	b.sendText(chatID, fmt.Sprintf("Broadcast #%d started. I'll report here when it's done, /admin broadcasts shows progress.", bc.ID))
+}
+
+func (b *Bot) adminBroadcasts(ctx context.Context, chatID int64) {
+	bcs, err := b.broadcastRepo.Recent(ctx, 5)
+	if err != nil {
+		slog.Error("failed to list broadcasts", "chat_id", chatID, "error", err)
+		b.sendText(chatID, "Failed to load broadcasts.")
+		return
+	}
+	if len(bcs) == 0 {
+		b.sendText(chatID, "No broadcasts yet.")
+		return
+	}
+
+	var sb strings.Builder
+	for _, bc := range bcs {
+		fmt.Fprintf(&sb, "#%d %s (%s): %d sent, %d blocked, %d failed\n",
+			bc.ID, bc.Status, bc.CreatedAt.Format("2006-01-02 15:04"), bc.Sent, bc.Blocked, bc.Failed)
+	}
+	b.sendText(chatID, sb.String())
+}
+
+func (b *Bot) adminCancelBroadcast(ctx context.Context, chatID int64, args string) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(strings.TrimSpace(args), "#"), 10, 64)
+	if err != nil {
+		b.sendText(chatID, "Usage: /admin cancel <broadcast id>")
+		return
+	}
+
+	cancelled, err := b.broadcastRepo.Finish(ctx, id, models.BroadcastCancelled)
+	if err != nil {
+		slog.Error("failed to cancel broadcast", "broadcast_id", id, "error", err)
+		b.sendText(chatID, "Failed to cancel the broadcast.")
+		return
+	}
+	if !cancelled {
+		b.sendText(chatID, fmt.Sprintf("Broadcast #%d is not running.", id))
+		return
+	}
+
+	b.sendText(chatID, fmt.Sprintf("Broadcast #%d cancelled.", id))
+}
+
+// parseUserID reads a Telegram user id argument, replying with an error when it is not one
+func (b *Bot) parseUserID(chatID int64, arg string) (int64, bool) {
+	id, err := strconv.ParseInt(strings.TrimSpace(arg), 10, 64)
+	if err != nil || id <= 0 {
+		b.sendText(chatID, "Please provide a numeric Telegram user id.")
+		return 0, false
+	}
+	return id, true
+}
+
+// userDailyLimit is the daily token limit for the sender of the current update
+func (b *Bot) userDailyLimit(ctx context.Context) int64 {
+	if user := userFrom(ctx); user != nil && user.DailyTokens != nil {
+		return *user.DailyTokens
+	}
+	return b.limits.DailyTokens
+}
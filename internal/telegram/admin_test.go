@@ -0,0 +1,31 @@
+package telegram
+
+import (
+	"testing"
+
+	"github.com/nurashi/Newton/internal/config"
+	"github.com/nurashi/Newton/internal/models"
+)
+
+func TestIsAdminUser(t *testing.T) {
+	b := &Bot{cfg: config.Telegram{AdminIDs: []int64{1}}}
+
+	tests := []struct {
+		name string
+		user *models.User
+		want bool
+	}{
+		{"configured admin", &models.User{ID: 1, Role: models.RoleUser}, true},
+		// promoted with /admin role, not in the configuration
+		{"admin role", &models.User{ID: 2, Role: models.RoleAdmin}, true},
+		{"regular user", &models.User{ID: 3, Role: models.RoleUser}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := b.isAdminUser(tt.user); got != tt.want {
+				t.Errorf("isAdminUser(%d, %q) = %v, want %v", tt.user.ID, tt.user.Role, got, tt.want)
+			}
+		})
+	}
+}
@@ -3,226 +3,282 @@ package telegram
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/nurashi/Newton/internal/ai"
+	"github.com/nurashi/Newton/internal/config"
+	"github.com/nurashi/Newton/internal/documents"
 	"github.com/nurashi/Newton/internal/handlers"
+	"github.com/nurashi/Newton/internal/metrics"
 	"github.com/nurashi/Newton/internal/models"
+	"github.com/nurashi/Newton/internal/ratelimit"
 	"github.com/nurashi/Newton/internal/repository"
 )
 
+// historyLimit is how many recent messages are sent to the AI as context
+const historyLimit = 20
+
+// Deps are the services the bot is wired with
+type Deps struct {
+	Users         *repository.UserRepository
+	Conversations *repository.ConversationRepository
+	Documents     *repository.DocumentRepository
+	Usage         *repository.UsageRepository
+	Broadcasts    *repository.BroadcastRepository
+	Errors        *repository.ErrorRepository
+	ChatSettings  *repository.ChatSettingsRepository
+	Inline        *repository.InlineRepository
+	Provider      ai.Provider
+	// Embedder is optional, without it documents are searched by keywords
+	Embedder ai.Embedder
+	// Transcriber and Speaker are optional, they enable voice messages and voice replies
+	Transcriber ai.Transcriber
+	Speaker     ai.Speaker
+	Limits      config.Limits
+}
+
 // Bot represents the Telegram bot instance
 type Bot struct {
-	api         *tgbotapi.BotAPI
-	userRepo    *repository.UserRepository
-	userHistory map[int64][]ai.Message
-	pdfContext  map[int64]string
+	api           *tgbotapi.BotAPI
+	cfg           config.Telegram
+	userRepo      *repository.UserRepository
+	convRepo      *repository.ConversationRepository
+	docRepo       *repository.DocumentRepository
+	usageRepo     *repository.UsageRepository
+	broadcastRepo *repository.BroadcastRepository
+	errorRepo     *repository.ErrorRepository
+	settingsRepo  *repository.ChatSettingsRepository
+	inlineRepo    *repository.InlineRepository
+	provider      ai.Provider
+	embedder      ai.Embedder
+	transcriber   ai.Transcriber
+	speaker       ai.Speaker
+	activeDocs    *chatStore[activeDocument]
+	settings      *settingsCache
+	images        *imageCache
+	// mention matches the bot's @username in group messages
+	mention *regexp.Regexp
+
+	limits      config.Limits
+	userLimiter *ratelimit.Limiter
+	chatLimiter *ratelimit.Limiter
+
+	router        *router
+	placeholders  *placeholders
+	broadcasts    *broadcasts
+	inline        *inlineQueries
+	webhookServer *http.Server
+	webhookQueue  *webhookQueue
 }
 
 // NewBot creates a new Telegram bot instance
-func NewBot(userRepo *repository.UserRepository) (*Bot, error) {
-	botToken := os.Getenv("TELEGRAM_BOT_TOKEN")
-	if botToken == "" {
+func NewBot(cfg config.Telegram, deps Deps) (*Bot, error) {
+	if cfg.Token == "" {
 		return nil, fmt.Errorf("TELEGRAM_BOT_TOKEN not set")
 	}
 
-	api, err := tgbotapi.NewBotAPI(botToken)
+	api, err := tgbotapi.NewBotAPI(cfg.Token)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create bot: %w", err)
 	}
 
 	api.Debug = false
 
-	return &Bot{
-		api:         api,
-		userRepo:    userRepo,
-		userHistory: make(map[int64][]ai.Message),
-		pdfContext:  make(map[int64]string),
-	}, nil
+	b := &Bot{
+		api:           api,
+		cfg:           cfg,
+		userRepo:      deps.Users,
+		convRepo:      deps.Conversations,
+		docRepo:       deps.Documents,
+		usageRepo:     deps.Usage,
+		broadcastRepo: deps.Broadcasts,
+		errorRepo:     deps.Errors,
+		settingsRepo:  deps.ChatSettings,
+		inlineRepo:    deps.Inline,
+		provider:      deps.Provider,
+		embedder:      deps.Embedder,
+		transcriber:   deps.Transcriber,
+		speaker:       deps.Speaker,
+		activeDocs:    newChatStore[activeDocument](),
+		settings:      newSettingsCache(),
+		images:        newImageCache(),
+		mention:       mentionPattern(api.Self.UserName),
+
+		limits:      deps.Limits,
+		userLimiter: ratelimit.New(deps.Limits.UserPerMinute, deps.Limits.UserBurst),
+		chatLimiter: ratelimit.New(deps.Limits.ChatPerMinute, deps.Limits.ChatBurst),
+
+		placeholders: newPlaceholders(),
+		broadcasts:   newBroadcasts(),
+		inline:       newInlineQueries(),
+	}
+	b.router = b.newCommandRouter()
+
+	return b, nil
 }
 
-func (b *Bot) Run() error {
-	log.Printf("Bot @%s started successfully", b.api.Self.UserName)
+// Run processes updates until ctx is cancelled, then shuts down gracefully
+func (b *Bot) Run(ctx context.Context) error {
+	slog.Info("bot started", "username", b.api.Self.UserName, "mode", b.cfg.Mode)
+
+	updates, err := b.updates()
+	if err != nil {
+		return err
+	}
+
+	// handlers outlive ctx so in-flight requests can finish during shutdown
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
 
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 30
+	d := newDispatcher(workCtx, b.cfg.Workers, b.cfg.QueueSize, b.handleUpdate, b.notifySkipped)
+	b.resumeBroadcasts(ctx)
+	b.publishCommands(ctx)
 
-	updates := b.api.GetUpdatesChan(u)
+	// busy tracks when each chat was last told its shard is full, one notice per busyNoticeInterval
+	busy := make(map[int64]time.Time)
 
-	for update := range updates {
-		go b.handleUpdate(update)
+	for {
+		select {
+		case <-ctx.Done():
+			return b.shutdown(d, cancelWork)
+		case update, ok := <-updates:
+			if !ok {
+				b.shutdown(d, cancelWork)
+				return fmt.Errorf("update channel closed")
+			}
+			if !d.Dispatch(update) {
+				b.rejectUpdate(update, busy)
+			}
+		}
 	}
+}
 
-	return nil
+const (
+	// busyNoticeInterval keeps a flooding chat from getting a busy notice for every rejected update
+	busyNoticeInterval = 10 * time.Second
+	// maxBusyChats bounds the notice timestamps kept while many chats are rejected at once
+	maxBusyChats = 10000
+)
+
+const busyNotice = "⏳ I'm still busy with earlier messages, please resend this one in a moment."
+
+// rejectUpdate handles an update the dispatcher had no room for, the notice is sent in the
+// background so a slow Telegram API can't stall intake either
+func (b *Bot) rejectUpdate(update tgbotapi.Update, busy map[int64]time.Time) {
+	kind, _ := b.updateKind(update)
+	metrics.UpdatesRejectedTotal.WithLabelValues(kind).Inc()
+	slog.Warn("worker queue full, rejecting update", "update_id", update.UpdateID, "type", kind)
+
+	key := updateKey(update)
+	now := time.Now()
+	if now.Sub(busy[key]) < busyNoticeInterval {
+		return
+	}
+	if len(busy) >= maxBusyChats {
+		clear(busy)
+	}
+	busy[key] = now
+
+	switch {
+	case update.CallbackQuery != nil:
+		go b.answerCallback(update.CallbackQuery.ID, busyNotice)
+	case update.Message != nil:
+		if isGroup(update.Message.Chat) && !b.addressed(update.Message) {
+			return
+		}
+		go b.sendText(update.Message.Chat.ID, busyNotice)
+	}
 }
 
-func (b *Bot) handleUpdate(update tgbotapi.Update) {
-	if update.Message == nil {
+func (b *Bot) handleUpdate(ctx context.Context, update tgbotapi.Update) {
+	defer b.recoverUpdate(ctx, update)
+	b.countUpdate(update)
+
+	switch {
+	case update.InlineQuery != nil:
+		b.handleInlineQuery(ctx, update.InlineQuery)
+		return
+	case update.ChosenInlineResult != nil:
+		b.handleChosenInlineResult(ctx, update.ChosenInlineResult)
+		return
+	case update.CallbackQuery != nil && strings.HasPrefix(update.CallbackQuery.Data, docsActionPrefix):
+		b.handleDocsCallback(ctx, update.CallbackQuery)
+		return
+	case update.CallbackQuery != nil:
+		b.handleCallbackQuery(ctx, update.CallbackQuery)
+		return
+	case update.Message == nil:
+		return
+	}
+	if isGroup(update.Message.Chat) && !b.addressed(update.Message) {
 		return
 	}
 
-	ctx := context.Background()
-	telegramUser := b.extractTelegramUser(update.Message.From)
+	ctx, meter := ai.WithMeter(ctx)
+	defer b.recordUsage(ctx, update.Message.From.ID, meter)
 
-	user, err := b.userRepo.CreateOrUpdate(ctx, telegramUser)
-	if err != nil {
-		log.Printf("Failed to save user %d: %v", update.Message.From.ID, err)
-	} else {
-		log.Printf("User saved/updated: ID=%d, Username=%s, FirstName=%s",
-			user.ID,
-			b.stringPtrToString(user.Username),
-			user.FirstName)
+	ctx, ok := b.identify(ctx, update.Message.From, update.Message.Chat.ID)
+	if !ok {
+		return
 	}
 
 	switch {
 	case update.Message.IsCommand():
-		b.handleCommand(update.Message)
+		b.handleCommand(ctx, update.Message)
 	case update.Message.Text != "":
-		b.handleTextMessage(update.Message)
+		b.handleTextMessage(ctx, update.Message)
+	case len(update.Message.Photo) > 0:
+		b.handlePhoto(ctx, update.Message)
+	case update.Message.Voice != nil || update.Message.Audio != nil:
+		b.handleVoice(ctx, update.Message)
 	case update.Message.Document != nil:
-		b.handleDocument(update.Message)
+		b.handleDocument(ctx, update.Message)
 	default:
-		b.sendMessage(update.Message.Chat.ID, "I only support text messages, documents, and commands for now.")
+		b.sendMessage(update.Message.Chat.ID, "I only support text messages, photos, voice messages, documents, and commands for now.")
 	}
 }
 
-func (b *Bot) handleCommand(message *tgbotapi.Message) {
-	chatID := message.Chat.ID
-	userID := message.From.ID
-
-	ctx := context.Background()
-	b.userRepo.UpdateLastSeen(ctx, int64(userID))
-
-	switch message.Command() {
-	case "start":
-		user, err := b.userRepo.GetByID(ctx, int64(userID))
-		var firstName string
-		if err == nil {
-			firstName = user.FirstName
-		} else {
-			firstName = message.From.FirstName
-		}
-
-		welcomeMsg := fmt.Sprintf(`Hello %s! Welcome to Newton AI Bot! 
-
-
-use /help to see all available commands
-
-Just send me any message and I'll respond using AI!`, firstName)
-
-		b.sendMessage(chatID, welcomeMsg)
-
-	case "help":
-
-		helpMsg := `
-	
-	Commands:
-/help - Show this help message.
-/clear - Clear conversation history(ai will forget all messanges).
-/profile - Show your profile information.
-/stats - Show your usage statistics.
-/weather <city> - provides weather.
-/pitch <topic> - provides idea to pitch by following topic.
-/photo <topic> - shows some photo of provided topic by some author.
-/image <topic> - generates image by provided topic. 
-	
-	`
-
-		b.sendMessage(chatID, helpMsg)
-
-	case "clear":
-		delete(b.userHistory, chatID)
-		b.sendMessage(chatID, "Conversation history cleared!")
-
-	case "profile":
-		b.handleProfileCommand(chatID, int64(userID))
-
-	case "stats":
-		b.handleStatsCommand(chatID, int64(userID))
-	case "weather":
-		args := message.CommandArguments()
-		if args == "" {
-			b.sendMessage(chatID, "Please provide a city name. Example: /weather London")
-			return
-		}
-
-		weatherInfo, err := handlers.GetWeather(args)
-		if err != nil {
-			log.Printf("Weather API error: %v", err)
-			b.sendMessage(chatID, "Sorry, I couldn't fetch the weather right now.")
-			return
-		}
-
-		b.sendMessage(chatID, weatherInfo)
-	case "pitch":
-		args := message.CommandArguments()
-		if args == "" {
-			b.sendMessage(chatID, "Please provide your startup idea. Example: /pitch AI tool for lawyers")
-			return
-		}
-		thinkingMsg := tgbotapi.NewMessage(chatID, "Generating your pitch, please wait...")
-		sent, err := b.api.Send(thinkingMsg)
-		if err != nil {
-			log.Printf("ERROR: Failed to send thinking message: %v", err)
-		}
-
-		pitch, err := ai.GeneratePitch(args)
-		if err != nil {
-			log.Printf("ERROR: failed to generate pitch: %v", err)
-			edit := tgbotapi.NewEditMessageText(chatID, sent.MessageID, "Sorry, I couldn't generate pitch right now.")
-			b.api.Send(edit)
-			return
-		}
-
-		edit := tgbotapi.NewEditMessageText(chatID, sent.MessageID, pitch)
-		b.api.Send(edit)
+// identify saves the sender and stores their profile in ctx, false when they are banned
+func (b *Bot) identify(ctx context.Context, from *tgbotapi.User, chatID int64) (context.Context, bool) {
+	user, err := b.userRepo.CreateOrUpdate(ctx, b.extractTelegramUser(from))
+	if err != nil {
+		slog.Error("failed to save user", "user_id", from.ID, "error", err)
+		return ctx, true
+	}
 
-	case "photo":
-		query := message.CommandArguments()
-		if query == "" {
-			b.sendMessage(message.Chat.ID, "Usage: /photo <query>")
-			return
-		}
+	slog.Debug("user saved", "user_id", user.ID, "chat_id", chatID)
+	if user.BannedAt != nil && !slices.Contains(b.cfg.AdminIDs, user.ID) {
+		slog.Debug("ignoring banned user", "user_id", user.ID, "chat_id", chatID)
+		return ctx, false
+	}
 
-		url, caption, err := handlers.SendUnsplashPhoto(chatID, query)
-		if err != nil {
-			b.sendMessage(chatID, "can't find photo for now")
-			return
-		}
+	return withUser(ctx, user), true
+}
 
-		msg := tgbotapi.NewPhoto(chatID, tgbotapi.FileURL(url))
-		msg.Caption = caption
-		if _, err := b.api.Send(msg); err != nil {
-			log.Printf("ERROR: failed to send msg from unsplash: %v", err)
-			return
-		}
-	case "image":
-		prompt := message.CommandArguments()
+func (b *Bot) handleCommand(ctx context.Context, message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	userID := message.From.ID
 
-		url, caption, err := handlers.SendAIImage(prompt)
-		if err != nil {
-			b.sendMessage(chatID, "can't generate image for now")
-		}
-		msg := tgbotapi.NewPhoto(chatID, tgbotapi.FileURL(url))
-		msg.Caption = caption
-		b.api.Send(msg)
+	b.userRepo.UpdateLastSeen(ctx, userID)
+	slog.Info("command received", "chat_id", chatID, "user_id", userID, "command", message.Command())
 
-	default:
+	if !b.router.dispatch(ctx, message) {
 		b.sendMessage(chatID, "Unknown command. Use /help to see available commands.")
 	}
 }
 
-func (b *Bot) handleProfileCommand(chatID, userID int64) {
-	log.Printf("DEBUG: handleProfileCommand called for chatID=%d userID=%d", chatID, userID)
-	ctx := context.Background()
+func (b *Bot) handleProfileCommand(ctx context.Context, chatID, userID int64) {
 	user, err := b.userRepo.GetByID(ctx, userID)
-	log.Printf("DEBUG: user from DB: %+v", user)
 	if err != nil {
-		log.Printf("Failed to get user profile %d: %v", userID, err)
+		slog.Error("failed to get user profile", "chat_id", chatID, "user_id", userID, "error", err)
 		b.sendMessage(chatID, "Sorry, couldn't retrieve your profile information.")
 		return
 	}
@@ -245,131 +301,260 @@ Last seen: %s`,
 	)
 
 	b.sendMessage(chatID, profileMsg)
-	log.Printf("DEBUG: sending profile message to chat %d", chatID)
 }
 
-func (b *Bot) handleStatsCommand(chatID, userID int64) {
-	ctx := context.Background()
-	stats, err := b.userRepo.GetStats(ctx, userID)
-
+func (b *Bot) handleStatsCommand(ctx context.Context, chatID, userID int64) {
+	user, err := b.userRepo.GetByID(ctx, userID)
 	if err != nil {
-		log.Printf("Failed to get user stats %d: %v", userID, err)
+		slog.Error("failed to get user stats", "chat_id", chatID, "user_id", userID, "error", err)
 		b.sendMessage(chatID, "Sorry, couldn't retrieve your statistics.")
 		return
 	}
 
-	count := len(b.userHistory[chatID])
-	messageCount := stats["message_count"].(int)
+	count, err := b.convRepo.CountMessages(ctx, chatID)
+	if err != nil {
+		slog.Error("failed to count session messages", "chat_id", chatID, "error", err)
+	}
+
+	var inlineSent int64
+	inline, err := b.inlineRepo.CountByKind(ctx, userID)
+	if err != nil {
+		slog.Error("failed to count inline choices", "user_id", userID, "error", err)
+	}
+	for _, n := range inline {
+		inlineSent += n
+	}
 
 	statsMsg := fmt.Sprintf(`Your Statistics
 
 Total messages sent: %d
 Messages in current session: %d
+Inline answers shared: %d
 Member since: %s
 Last seen: %s`,
-		messageCount,
+		user.MessageCount,
 		count,
-		stats["member_since"],
-		stats["last_seen"])
+		inlineSent,
+		user.CreatedAt.Format("2006-01-02"),
+		user.LastSeen.Format("2006-01-02 15:04:05"))
 
 	b.sendMessage(chatID, statsMsg)
 }
 
-func (b *Bot) handleTextMessageLM(message *tgbotapi.Message) { // just exist, to test work with LM studio
-	ctx := context.Background()
-
-	b.userRepo.UpdateLastSeen(ctx, int64(message.From.ID))
-
-	log.Printf("User: %d (%s) in chat %d: %s", message.Chat.ID, message.From.UserName, message.Chat.ID, message.Text)
-
-	typing := tgbotapi.NewChatAction(message.Chat.ID, tgbotapi.ChatTyping)
-
-	b.api.Send(typing)
-
-	thinkingMsg := tgbotapi.NewMessage(message.Chat.ID, "Thinking...")
-	send, err := b.api.Send(thinkingMsg)
-	if err != nil {
-		log.Printf("Failed to send thinking message: %v", err)
-		return
+func (b *Bot) handleTextMessage(ctx context.Context, message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	userID := message.From.ID
+	prompt := message.Text
+	group := isGroup(message.Chat)
+	if group {
+		prompt = b.stripMention(prompt)
+		if prompt == "" {
+			b.sendMessage(chatID, "Yes? Mention me together with your question.")
+			return
+		}
 	}
 
-	start := time.Now()
-	response, err := ai.LMStudioAPICall(message.Text) // message.text = prompt
-	duration := time.Since(start)
-
-	if err != nil {
-		log.Printf("ERROR: failed to get LM studio response: %v", err)
+	if !b.allowAI(ctx, chatID, userID) {
 		return
 	}
 
-	log.Printf("AI responded in %v", duration)
-
-	edit := tgbotapi.NewEditMessageText(message.Chat.ID, send.MessageID, response)
-
-	if _, err := b.api.Send(edit); err != nil {
-		log.Printf("Failed to edit message: %v", err)
-		b.sendMessage(message.Chat.ID, response)
+	if err := b.userRepo.IncrementMessageCount(ctx, userID); err != nil {
+		slog.Error("failed to increment message count", "user_id", userID, "error", err)
 	}
 
+	slog.Debug("text message received", "chat_id", chatID, "user_id", userID, "chars", len(prompt))
+
+	b.answer(ctx, aiTurn{
+		chatID:  chatID,
+		userID:  userID,
+		group:   group,
+		replyTo: replyTarget(message),
+		prompt:  prompt,
+	})
 }
 
-func (b *Bot) handleTextMessage(message *tgbotapi.Message) {
-	chatID := message.Chat.ID
-	userID := message.From.ID
-	prompt := message.Text
+// aiTurn is one AI answer in a chat
+type aiTurn struct {
+	chatID int64
+	userID int64
+	group  bool
+	// replyTo is the message the answer replies to, 0 for none
+	replyTo int
+	// prompt is saved to the history as the user's turn
+	prompt string
+	// imageFileID is the photo the prompt asks about
+	imageFileID *string
+	// speak sends the answer as a voice note too
+	speak bool
+	// regenerate is the last answer of the chat, it is answered again and replaced instead of adding a turn
+	regenerate *models.ConversationMessage
+}
 
-	ctx := context.Background()
+// answer streams the AI answer to a turn and stores it in the chat's history, false when it failed
+func (b *Bot) answer(ctx context.Context, turn aiTurn) bool {
+	chatID, userID := turn.chatID, turn.userID
 
-	if err := b.userRepo.IncrementMessageCount(ctx, int64(userID)); err != nil {
-		log.Printf("Failed to increment message count for user %d: %v", userID, err)
+	settings, err := b.chatSettings(ctx, chatID)
+	if err != nil {
+		slog.Error("failed to load chat settings", "chat_id", chatID, "error", err)
+		b.sendMessage(chatID, settingsUnavailable)
+		return false
 	}
 
-	log.Printf("User %d (%s) in chat %d: %s",
-		userID, message.From.UserName, chatID, prompt)
-
 	typing := tgbotapi.NewChatAction(chatID, tgbotapi.ChatTyping)
 	b.api.Send(typing)
 
-	thinkingMsg := tgbotapi.NewMessage(chatID, "Thinking...")
-	sent, err := b.api.Send(thinkingMsg)
+	sent, err := b.sendPlaceholder(chatID, turn.replyTo, "Thinking...")
 	if err != nil {
-		log.Printf("Failed to send thinking message: %v", err)
-		return
+		slog.Error("failed to send placeholder", "chat_id", chatID, "error", err)
+		return false
 	}
 
-	b.userHistory[chatID] = append(b.userHistory[chatID], ai.Message{
-		Role:    "user",
-		Content: prompt,
-	})
+	var userMsg *models.ConversationMessage
+	if turn.regenerate == nil {
+		userMsg, err = b.convRepo.AddImageMessage(ctx, chatID, userID, ai.RoleUser, turn.prompt, turn.imageFileID)
+		if err != nil {
+			slog.Error("failed to save message", "chat_id", chatID, "user_id", userID, "error", err)
+			b.editOrSendMessage(chatID, sent.MessageID, failureText(ctx, "Sorry, I'm having trouble processing your request. Please try again later."))
+			b.releasePlaceholder(chatID, sent.MessageID)
+			return false
+		}
+	}
+
+	history, err := b.loadHistory(ctx, chatID, turn.group)
+	switch {
+	case err != nil && turn.regenerate != nil:
+		slog.Error("failed to load history", "chat_id", chatID, "error", err)
+		b.editOrSendMessage(chatID, sent.MessageID, failureText(ctx, "Sorry, I couldn't regenerate the answer. Please try again later."))
+		b.releasePlaceholder(chatID, sent.MessageID)
+		return false
+	case err != nil:
+		slog.Error("failed to load history", "chat_id", chatID, "error", err)
+		history = []ai.Message{{Role: ai.RoleUser, Content: turn.prompt}}
+		if turn.imageFileID != nil {
+			b.attachImage(ctx, &history[0], *turn.imageFileID)
+		}
+	case turn.regenerate != nil:
+		// the answer being replaced is the last message, it is asked again without it
+		if n := len(history); n > 0 && history[n-1].Role == ai.RoleAssistant {
+			history = history[:n-1]
+		}
+		if n := len(history); n > 0 {
+			turn.prompt = history[n-1].Content
+		}
+	}
 
-	if len(b.userHistory[chatID]) > 20 {
-		b.userHistory[chatID] = b.userHistory[chatID][len(b.userHistory[chatID])-20:]
+	messages := ai.WithSystemPrompt(systemPrompt(settings, turn.group), history)
+	docPrompt, sources, ok := b.documentContext(ctx, chatID, turn.prompt)
+	if ok {
+		messages = ai.WithSystemPrompt(docPrompt, messages)
 	}
 
 	start := time.Now()
-	response, err := ai.AskGeminiWithHistory(b.userHistory[chatID])
+	writer := b.newStreamWriter(chatID, sent.MessageID)
+	defer writer.Release()
+	resp, err := b.provider.ChatStream(ctx, messages, writer.Write)
 	duration := time.Since(start)
 
+	var suffix string
+	var answerID int64
 	if err != nil {
-		log.Printf("AI request failed: %v", err)
-		response = "Sorry, I'm having trouble processing your request. Please try again later."
+		slog.Error("AI request failed", "chat_id", chatID, "user_id", userID, "provider", b.provider.Name(), "model", b.provider.Model(), "latency_ms", duration.Milliseconds(), "error", err)
+		suffix = failureText(ctx, "Sorry, I'm having trouble processing your request. Please try again later.")
+		if writer.received {
+			suffix = "\n\n_(answer was interrupted, please try again)_"
+		}
 
-		if len(b.userHistory[chatID]) > 0 {
-			b.userHistory[chatID] = b.userHistory[chatID][:len(b.userHistory[chatID])-1]
+		// the request context may be gone already, the rollback must still happen
+		if userMsg != nil {
+			if err := b.convRepo.DeleteMessage(context.WithoutCancel(ctx), userMsg.ID); err != nil {
+				slog.Error("failed to roll back unanswered message", "chat_id", chatID, "message_id", userMsg.ID, "error", err)
+			}
 		}
 	} else {
-		b.userHistory[chatID] = append(b.userHistory[chatID], ai.Message{
-			Role:    "assistant",
-			Content: response,
-		})
+		if !writer.received {
+			suffix = resp.Text
+		}
+		suffix += sourcesFooter(sources)
+		answerID = b.saveAnswer(ctx, turn, resp.Text)
+
+		slog.Info("AI responded",
+			"chat_id", chatID,
+			"user_id", userID,
+			"provider", b.provider.Name(),
+			"model", b.provider.Model(),
+			"latency_ms", duration.Milliseconds(),
+			"prompt_tokens", resp.Usage.PromptTokens,
+			"completion_tokens", resp.Usage.CompletionTokens,
+			"tokens", resp.Usage.TotalTokens)
+	}
+
+	// Render the final markdown version (handles long messages)
+	lastID, err := writer.Finish(suffix)
+	if err != nil {
+		slog.Error("failed to send response", "chat_id", chatID, "error", err)
+		return answerID != 0
+	}
 
-		log.Printf("AI responded in %v for user %d", duration, userID)
+	if answerID != 0 {
+		if lastID != 0 {
+			b.attachActions(ctx, chatID, lastID, answerID)
+		}
+		if turn.speak {
+			b.speak(ctx, chatID, turn.replyTo, resp.Text)
+		}
 	}
+	return answerID != 0
+}
 
-	// Send response (handles long messages and markdown)
-	if err := b.sendLongMessage(chatID, sent.MessageID, response, true); err != nil {
-		log.Printf("Failed to send response: %v", err)
+// saveAnswer stores the answer of turn and returns its id, 0 when it couldn't be stored
+func (b *Bot) saveAnswer(ctx context.Context, turn aiTurn, text string) int64 {
+	if turn.regenerate != nil {
+		if err := b.convRepo.UpdateContent(ctx, turn.regenerate.ID, text); err != nil {
+			slog.Error("failed to replace AI response", "chat_id", turn.chatID, "message_id", turn.regenerate.ID, "error", err)
+			return 0
+		}
+		return turn.regenerate.ID
 	}
+
+	msg, err := b.convRepo.AddMessage(ctx, turn.chatID, turn.userID, ai.RoleAssistant, text)
+	if err != nil {
+		slog.Error("failed to save AI response", "chat_id", turn.chatID, "error", err)
+		return 0
+	}
+	return msg.ID
+}
+
+// loadHistory returns the recent conversation of a chat in provider format,
+// in groups user messages are prefixed with the sender's name.
+// The latest photos are attached again so follow-up questions can refer to them.
+func (b *Bot) loadHistory(ctx context.Context, chatID int64, group bool) ([]ai.Message, error) {
+	stored, err := b.convRepo.RecentMessages(ctx, chatID, historyLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]ai.Message, len(stored))
+	images := 0
+	for i := len(stored) - 1; i >= 0; i-- {
+		msg := stored[i]
+		content := msg.Content
+		if group && msg.Role == ai.RoleUser && msg.AuthorName != nil {
+			content = *msg.AuthorName + ": " + content
+		}
+		history[i] = ai.Message{Role: msg.Role, Content: content}
+
+		if msg.ImageFileID != nil {
+			if images < maxHistoryImages {
+				b.attachImage(ctx, &history[i], *msg.ImageFileID)
+			} else {
+				history[i].Content += "\n[an earlier image, no longer attached]"
+			}
+			images++
+		}
+	}
+
+	return history, nil
 }
 
 func (b *Bot) sendMessage(chatID int64, text string) {
@@ -377,7 +562,14 @@ func (b *Bot) sendMessage(chatID int64, text string) {
 	msg.ParseMode = tgbotapi.ModeMarkdown
 
 	if _, err := b.api.Send(msg); err != nil {
-		log.Printf("Failed to send message to chat %d: %v", chatID, err)
+		slog.Error("failed to send message", "chat_id", chatID, "error", err)
+	}
+}
+
+// sendText sends text as is, for content that may contain markdown characters such as usernames
+func (b *Bot) sendText(chatID int64, text string) {
+	if _, err := b.api.Send(tgbotapi.NewMessage(chatID, text)); err != nil {
+		slog.Error("failed to send message", "chat_id", chatID, "error", err)
 	}
 }
 
@@ -449,6 +641,9 @@ func sanitizeMarkdown(text string) string {
 	return finalText
 }
 
+// maxTelegramLength leaves headroom below Telegram's 4096 character message limit
+const maxTelegramLength = 4000
+
 // splitLongMessage splits message into chunks under maxLen chars
 func splitLongMessage(text string, maxLen int) []string {
 	if len(text) <= maxLen {
@@ -499,10 +694,9 @@ func splitLongMessage(text string, maxLen int) []string {
 	return chunks
 }
 
-// sendLongMessage sends a message, splitting if necessary
-func (b *Bot) sendLongMessage(chatID int64, messageID int, text string, isEdit bool) error {
-	const maxTelegramLength = 4000
-
+// sendLongMessage sends a message, splitting if necessary, and returns the id of the
+// last message it sent or edited, which is where reply buttons belong
+func (b *Bot) sendLongMessage(chatID int64, messageID int, text string, isEdit bool) (int, error) {
 	text = sanitizeMarkdown(text)
 
 	chunks := splitLongMessage(text, maxTelegramLength)
@@ -513,15 +707,15 @@ func (b *Bot) sendLongMessage(chatID int64, messageID int, text string, isEdit b
 			edit.ParseMode = "Markdown"
 
 			if _, err := b.api.Send(edit); err != nil {
-				log.Printf("Markdown failed, trying plain text: %v", err)
+				slog.Debug("markdown edit failed, trying plain text", "chat_id", chatID, "error", err)
 				edit.ParseMode = ""
 				if _, err := b.api.Send(edit); err != nil {
-					return b.sendPlainMessage(chatID, text)
+					return b.sendPart(chatID, text)
 				}
 			}
-			return nil
+			return messageID, nil
 		}
-		return b.sendPlainMessage(chatID, text)
+		return b.sendPart(chatID, text)
 	}
 
 	if isEdit {
@@ -529,6 +723,7 @@ func (b *Bot) sendLongMessage(chatID int64, messageID int, text string, isEdit b
 		b.api.Send(deleteMsg)
 	}
 
+	var lastID int
 	for i, chunk := range chunks {
 		var msgText string
 		if len(chunks) > 1 {
@@ -537,47 +732,58 @@ func (b *Bot) sendLongMessage(chatID int64, messageID int, text string, isEdit b
 			msgText = chunk
 		}
 
-		if err := b.sendPlainMessage(chatID, msgText); err != nil {
-			return err
+		id, err := b.sendPart(chatID, msgText)
+		if err != nil {
+			return lastID, err
 		}
+		lastID = id
 
 		if i < len(chunks)-1 {
 			time.Sleep(200 * time.Millisecond)
 		}
 	}
 
-	return nil
+	return lastID, nil
 }
 
 // sendPlainMessage sends a single message with markdown fallback
 func (b *Bot) sendPlainMessage(chatID int64, text string) error {
+	_, err := b.sendPart(chatID, text)
+	return err
+}
+
+// sendPart is sendPlainMessage returning the id of the sent message
+func (b *Bot) sendPart(chatID int64, text string) (int, error) {
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.ParseMode = "Markdown"
 
-	_, err := b.api.Send(msg)
+	sent, err := b.api.Send(msg)
 	if err != nil {
-		log.Printf("Markdown failed, sending plain text: %v", err)
+		slog.Debug("markdown send failed, sending plain text", "chat_id", chatID, "error", err)
 		msg.ParseMode = ""
 
 		msg.Text = strings.ReplaceAll(text, "```", "")
 		msg.Text = strings.ReplaceAll(msg.Text, "`", "")
 		msg.Text = strings.ReplaceAll(msg.Text, "*", "")
 		msg.Text = strings.ReplaceAll(msg.Text, "_", "")
-		_, err = b.api.Send(msg)
+		sent, err = b.api.Send(msg)
 	}
 
-	return err
+	return sent.MessageID, err
 }
 
-func RunTelegramBot(userService *repository.UserRepository) {
-	bot, err := NewBot(userService)
+// RunTelegramBot runs the bot until ctx is cancelled
+func RunTelegramBot(ctx context.Context, cfg config.Telegram, deps Deps) error {
+	bot, err := NewBot(cfg, deps)
 	if err != nil {
-		log.Fatalf("Failed to create bot: %v", err)
+		return fmt.Errorf("failed to create bot: %w", err)
 	}
 
-	if err := bot.Run(); err != nil {
-		log.Fatalf("Bot failed: %v", err)
+	if err := bot.Run(ctx); err != nil {
+		return fmt.Errorf("bot failed: %w", err)
 	}
+
+	return nil
 }
 
 // my username is nurasyl_orazbek, and "_" gives error at query.
@@ -605,54 +811,62 @@ func escapeMarkdownV2(s string) string {
 	return replacer.Replace(s)
 }
 
-func (b *Bot) handleDocument(message *tgbotapi.Message) {
+func (b *Bot) handleDocument(ctx context.Context, message *tgbotapi.Message) {
 	chatID := message.Chat.ID
 	file := message.Document
-	filename := strings.ToLower(file.FileName)
 
-	// Check supported file types
-	ext := handlers.GetFileExtension(filename)
-	if ext != "pdf" && ext != "pptx" {
-		b.sendMessage(chatID, "Supported formats: PDF and PPTX files only")
+	format, ok := handlers.LookupFormat(file.FileName, file.MimeType)
+	if !ok {
+		b.sendMessage(chatID, "Supported formats: "+strings.Join(handlers.SupportedFormats(), ", "))
+		return
+	}
+	ext := strings.ToLower(format.Name)
+
+	if !b.allowAI(ctx, chatID, message.From.ID) {
+		return
+	}
+
+	if refusal := b.libraryRefusal(ctx, message.From.ID, 0); refusal != "" {
+		b.sendText(chatID, refusal)
 		return
 	}
 
 	typing := tgbotapi.NewChatAction(chatID, tgbotapi.ChatUploadDocument)
 	b.api.Send(typing)
 
-	fileTypeLabel := strings.ToUpper(ext)
-	processingMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Processing %s...", fileTypeLabel))
-	send, err := b.api.Send(processingMsg)
+	fileTypeLabel := format.Name
+	send, err := b.sendPlaceholder(chatID, replyTarget(message), fmt.Sprintf("Processing %s...", fileTypeLabel))
 
 	if err != nil {
-		log.Printf("Failed to send processing message: %v", err)
+		slog.Error("failed to send placeholder", "chat_id", chatID, "error", err)
 	}
+	defer b.releasePlaceholder(chatID, send.MessageID)
 
 	fileConfig := tgbotapi.FileConfig{FileID: file.FileID}
 	tgFile, err := b.api.GetFile(fileConfig)
 	if err != nil {
 		b.editOrSendMessage(chatID, send.MessageID, "Failed to get file from Telegram")
-		log.Printf("ERROR: failed to get file: %v", err)
+		slog.Error("failed to get file", "chat_id", chatID, "error", err)
 		return
 	}
 
 	fileURL := tgFile.Link(b.api.Token)
 	localPath := fmt.Sprintf("/tmp/%d_%s", time.Now().Unix(), file.FileName)
 
-	if err := handlers.DownloadFile(localPath, fileURL); err != nil {
-		b.sendMessage(chatID, fmt.Sprintf("Failed to download %s file", fileTypeLabel))
+	stageStart := time.Now()
+	if err := handlers.DownloadFile(ctx, localPath, fileURL); err != nil {
+		b.editOrSendMessage(chatID, send.MessageID, failureText(ctx, fmt.Sprintf("Failed to download %s file", fileTypeLabel)))
 		return
 	}
+	metrics.Since(metrics.DocumentProcessingDuration.WithLabelValues(ext, "download"), stageStart)
 
 	defer os.Remove(localPath)
 
-	var text string
-	switch ext {
-	case "pdf":
-		text, err = handlers.ExtractPDFText(localPath)
-	case "pptx":
-		text, err = handlers.ExtractPPTXText(localPath)
-	}
+	stageStart = time.Now()
+	sections, err := format.Extract(localPath)
+	// the joined text is for the guide, chunks are cut from the sections themselves
+	text := documents.Join(sections)
+	metrics.Since(metrics.DocumentProcessingDuration.WithLabelValues(ext, "extract"), stageStart)
 
 	if err != nil {
 		b.editOrSendMessage(chatID, send.MessageID, fmt.Sprintf("❌ Failed to read %s: %v", fileTypeLabel, err))
@@ -664,32 +878,62 @@ func (b *Bot) handleDocument(message *tgbotapi.Message) {
 		return
 	}
 
+	if refusal := b.libraryRefusal(ctx, message.From.ID, utf8.RuneCountInString(text)); refusal != "" {
+		b.editOrSendMessage(chatID, send.MessageID, refusal)
+		return
+	}
+
+	stageStart = time.Now()
+	doc, err := b.ingestDocument(ctx, chatID, message.From.ID, file.FileName, file.FileID, fileTypeLabel, sections)
+	metrics.Since(metrics.DocumentProcessingDuration.WithLabelValues(ext, "index"), stageStart)
+	if err != nil {
+		slog.Error("failed to index document", "chat_id", chatID, "file_type", ext, "error", err)
+		// questions must not be answered from the document that was active before this one
+		b.clearActiveDocument(ctx, chatID)
+		b.sendText(chatID, fmt.Sprintf("⚠️ Couldn't save %s, so questions about it are unavailable. The guide is still on its way.", file.FileName))
+	} else {
+		// Store context for follow-up questions
+		b.setActiveDocument(ctx, chatID, doc)
+	}
+
 	edit := tgbotapi.NewEditMessageText(chatID, send.MessageID, "🎓 Creating Educational Guide...")
 	b.api.Send(edit)
 
-	b.createEducationalGuide(chatID, send.MessageID, text, file.FileName, fileTypeLabel)
+	b.createEducationalGuide(ctx, chatID, send.MessageID, text, file.FileName, fileTypeLabel)
 }
 
-func (b *Bot) createEducationalGuide(chatID int64, messageID int, documentText string, filename string, fileType string) {
+func (b *Bot) createEducationalGuide(ctx context.Context, chatID int64, messageID int, documentText string, filename string, fileType string) {
 	startTime := time.Now()
 
-	response, err := ai.GenerateEducationalGuide(documentText, filename, fileType)
+	// onProgress is serialized by the ai package, lastEdit needs no lock
+	var lastEdit time.Time
+	onProgress := func(done, total int) {
+		if time.Since(lastEdit) < streamEditInterval && done < total {
+			return
+		}
+		lastEdit = time.Now()
+		edit := tgbotapi.NewEditMessageText(chatID, messageID, fmt.Sprintf("🎓 Creating Educational Guide... read %d of %d parts", done, total))
+		b.api.Send(edit)
+	}
+
+	response, err := ai.GenerateEducationalGuide(ctx, b.provider, documentText, filename, fileType, onProgress)
+	metrics.Since(metrics.DocumentProcessingDuration.WithLabelValues(strings.ToLower(fileType), "guide"), startTime)
 	if err != nil {
-		log.Printf("Educational guide generation failed: %v", err)
-		b.editOrSendMessage(chatID, messageID, fmt.Sprintf("Failed to generate guide: %v", err))
+		slog.Error("educational guide generation failed", "chat_id", chatID, "provider", b.provider.Name(), "error", err)
+		b.editOrSendMessage(chatID, messageID, failureText(ctx, fmt.Sprintf("Failed to generate guide: %v", err)))
 		return
 	}
 
-	fullResponse := fmt.Sprintf("*Educational Guide*\n `%s`\n\n%s\n\n_You can now ask me questions about this document!_", filename, response)
-
-	// Store context for follow-up questions
-	b.pdfContext[chatID] = documentText
+	fullResponse := fmt.Sprintf("*Educational Guide*\n `%s`\n\n%s", filename, response)
+	if _, ok := b.activeDocument(ctx, chatID); ok {
+		fullResponse += "\n\n_You can now ask me questions about this document!_"
+	}
 
-	if err := b.sendLongMessage(chatID, messageID, fullResponse, true); err != nil {
-		log.Printf("Failed to send educational guide: %v", err)
+	if _, err := b.sendLongMessage(chatID, messageID, fullResponse, true); err != nil {
+		slog.Error("failed to send educational guide", "chat_id", chatID, "error", err)
 	}
 
-	log.Printf("Educational guide created in %v for chat %d", time.Since(startTime), chatID)
+	slog.Info("educational guide created", "chat_id", chatID, "file_type", fileType, "latency_ms", time.Since(startTime).Milliseconds())
 }
 
 func (b *Bot) editOrSendMessage(chatID int64, messageID int, text string) {
@@ -697,7 +941,7 @@ func (b *Bot) editOrSendMessage(chatID int64, messageID int, text string) {
 	edit.ParseMode = "Markdown"
 
 	if _, err := b.api.Send(edit); err != nil {
-		log.Printf("Failed to edit message, sending new: %v", err)
+		slog.Debug("failed to edit message, sending new", "chat_id", chatID, "error", err)
 		b.sendMessage(chatID, text)
 	}
 }
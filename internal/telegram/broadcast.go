@@ -0,0 +1,253 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nurashi/Newton/internal/models"
+)
+
+const (
+	// broadcastInterval keeps broadcasts at ~25 messages per second, under Telegram's global
+	// limit of 30 with room left for regular replies
+	broadcastInterval = 40 * time.Millisecond
+	broadcastBatch    = 100
+	// broadcastAttempts bounds how often one recipient is retried after a 429 or a transient error
+	broadcastAttempts = 4
+	// broadcastBackoff is the first wait after a network error or a Telegram 5xx, doubled on every retry
+	broadcastBackoff = time.Second
+)
+
+// broadcasts runs broadcast jobs in the background. Progress is stored per recipient,
+// so jobs stopped by a restart continue where they left off.
+type broadcasts struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	throttle throttle
+
+	mu      sync.Mutex
+	stopped bool
+}
+
+func newBroadcasts() *broadcasts {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &broadcasts{ctx: ctx, cancel: cancel, throttle: throttle{interval: broadcastInterval}}
+}
+
+// add registers a job, false once stop has been called
+func (j *broadcasts) add() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.stopped {
+		return false
+	}
+	j.wg.Add(1)
+	return true
+}
+
+// stop interrupts running jobs and waits for them to save their progress
+func (j *broadcasts) stop() {
+	j.mu.Lock()
+	j.stopped = true
+	j.mu.Unlock()
+
+	j.cancel()
+	j.wg.Wait()
+}
+
+// throttle spaces sends out across all running broadcasts
+type throttle struct {
+	mu       sync.Mutex
+	next     time.Time
+	interval time.Duration
+}
+
+// wait blocks until the caller may send the next message
+func (t *throttle) wait(ctx context.Context) error {
+	t.mu.Lock()
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	slot := t.next
+	t.next = t.next.Add(t.interval)
+	t.mu.Unlock()
+
+	select {
+	case <-time.After(time.Until(slot)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pause holds every sender back for d, used when Telegram answers 429
+func (t *throttle) pause(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if until := time.Now().Add(d); t.next.Before(until) {
+		t.next = until
+	}
+}
+
+// startBroadcast runs bc in the background, during shutdown it is left for the next start to resume
+func (b *Bot) startBroadcast(bc models.Broadcast) {
+	if !b.broadcasts.add() {
+		slog.Info("shutting down, broadcast resumes on the next start", "broadcast_id", bc.ID)
+		return
+	}
+	go func() {
+		defer b.broadcasts.wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				// the job stays running in the database and is resumed on the next start
+				b.reportPanic(b.broadcasts.ctx, models.ErrorEvent{
+					ChatID:     &bc.ChatID,
+					UpdateType: "broadcast",
+					Message:    fmt.Sprint(r),
+					Stack:      string(debug.Stack()),
+				})
+			}
+		}()
+		b.runBroadcast(b.broadcasts.ctx, bc)
+	}()
+}
+
+// resumeBroadcasts restarts the jobs an earlier run did not finish
+func (b *Bot) resumeBroadcasts(ctx context.Context) {
+	running, err := b.broadcastRepo.Running(ctx)
+	if err != nil {
+		slog.Error("failed to load unfinished broadcasts", "error", err)
+		return
+	}
+
+	for _, bc := range running {
+		slog.Info("resuming broadcast", "broadcast_id", bc.ID, "cursor", bc.Cursor, "sent", bc.Sent)
+		b.startBroadcast(bc)
+	}
+}
+
+func (b *Bot) runBroadcast(ctx context.Context, bc models.Broadcast) {
+	cursor := bc.Cursor
+
+	for {
+		// a cancel from /admin cancel is noticed between batches
+		current, err := b.broadcastRepo.Get(ctx, bc.ID)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("failed to load broadcast", "broadcast_id", bc.ID, "error", err)
+			}
+			return
+		}
+		if current.Status != models.BroadcastRunning {
+			slog.Info("broadcast stopped", "broadcast_id", bc.ID, "status", current.Status)
+			return
+		}
+
+		ids, err := b.broadcastRepo.Recipients(ctx, bc.ID, cursor, broadcastBatch)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("failed to list broadcast recipients", "broadcast_id", bc.ID, "error", err)
+			}
+			return
+		}
+
+		if len(ids) == 0 {
+			b.finishBroadcast(ctx, bc.ID)
+			return
+		}
+
+		for _, id := range ids {
+			status, deliveryErr := b.deliver(ctx, id, bc.Text)
+			if status == "" {
+				// interrupted before sending, the recipient is tried again after the restart
+				return
+			}
+
+			// a message that went out must be recorded even when we are stopping
+			if err := b.broadcastRepo.RecordDelivery(context.WithoutCancel(ctx), bc.ID, id, status, deliveryErr); err != nil {
+				slog.Error("failed to record delivery", "broadcast_id", bc.ID, "user_id", id, "error", err)
+				return
+			}
+			cursor = id
+		}
+	}
+}
+
+// deliver sends one broadcast message, retrying after 429 responses and, with backoff, after
+// network errors and Telegram 5xx responses. The status is empty when ctx was cancelled before
+// the message was sent.
+func (b *Bot) deliver(ctx context.Context, chatID int64, text string) (string, *string) {
+	var err error
+	backoff := broadcastBackoff
+	for attempt := 1; attempt <= broadcastAttempts; attempt++ {
+		if err := b.broadcasts.throttle.wait(ctx); err != nil {
+			return "", nil
+		}
+
+		_, err = b.api.Send(tgbotapi.NewMessage(chatID, text))
+		if err == nil {
+			return models.DeliverySent, nil
+		}
+
+		var tgErr *tgbotapi.Error
+		var netErr net.Error
+		switch {
+		case errors.As(err, &tgErr) && tgErr.RetryAfter > 0:
+			slog.Warn("broadcast rate limited by Telegram", "retry_after", tgErr.RetryAfter)
+			b.broadcasts.throttle.pause(time.Duration(tgErr.RetryAfter) * time.Second)
+			continue
+		case tgErr != nil && tgErr.Code == 403:
+			// blocked by the user or the account was deleted
+			msg := tgErr.Message
+			return models.DeliveryBlocked, &msg
+		case (tgErr != nil && tgErr.Code >= 500) || (tgErr == nil && errors.As(err, &netErr)):
+			if attempt == broadcastAttempts {
+				break
+			}
+			slog.Warn("broadcast delivery failed, retrying", "user_id", chatID, "attempt", attempt, "wait_ms", backoff.Milliseconds(), "error", err)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				// the message was not delivered, the recipient is tried again after the restart
+				return "", nil
+			}
+			backoff *= 2
+			continue
+		}
+		break
+	}
+
+	msg := err.Error()
+	return models.DeliveryFailed, &msg
+}
+
+func (b *Bot) finishBroadcast(ctx context.Context, id int64) {
+	finished, err := b.broadcastRepo.Finish(ctx, id, models.BroadcastDone)
+	if err != nil {
+		slog.Error("failed to finish broadcast", "broadcast_id", id, "error", err)
+		return
+	}
+	if !finished {
+		return
+	}
+
+	bc, err := b.broadcastRepo.Get(ctx, id)
+	if err != nil {
+		slog.Error("failed to load broadcast", "broadcast_id", id, "error", err)
+		return
+	}
+
+	slog.Info("broadcast finished", "broadcast_id", id, "sent", bc.Sent, "blocked", bc.Blocked, "failed", bc.Failed)
+	b.sendText(bc.ChatID, fmt.Sprintf("Broadcast #%d finished: %d sent, %d blocked, %d failed.", bc.ID, bc.Sent, bc.Blocked, bc.Failed))
+}
@@ -0,0 +1,233 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nurashi/Newton/internal/ai"
+	"github.com/nurashi/Newton/internal/handlers"
+	"github.com/nurashi/Newton/internal/models"
+)
+
+// newCommandRouter registers every command of the bot, in the order they are listed in /help
+func (b *Bot) newCommandRouter() *router {
+	r := newRouter(b.sendText, b.recoverPanic, b.measure, b.authorize, b.commandEnabled)
+
+	r.register(
+		&command{
+			Name:        "start",
+			Description: "Start talking to the bot",
+			Handler:     b.handleStartCommand,
+		},
+		&command{
+			Name:        "help",
+			Description: "Show this help message",
+			Required:    true,
+			Handler:     b.handleHelpCommand,
+		},
+		&command{
+			Name:        "clear",
+			Description: "Clear conversation history, the AI forgets all messages",
+			Middleware:  []middleware{b.groupAdmin},
+			Handler:     b.handleClearCommand,
+		},
+		&command{
+			Name:        "profile",
+			Description: "Show your profile information",
+			Handler: func(ctx context.Context, message *tgbotapi.Message, _ string) {
+				b.handleProfileCommand(ctx, message.Chat.ID, message.From.ID)
+			},
+		},
+		&command{
+			Name:        "stats",
+			Description: "Show your usage statistics",
+			Handler: func(ctx context.Context, message *tgbotapi.Message, _ string) {
+				b.handleStatsCommand(ctx, message.Chat.ID, message.From.ID)
+			},
+		},
+		&command{
+			Name:        "quota",
+			Description: "Show how much of your AI budget is left",
+			Handler: func(ctx context.Context, message *tgbotapi.Message, _ string) {
+				b.handleQuotaCommand(ctx, message.Chat.ID, message.From.ID)
+			},
+		},
+		&command{
+			Name:        "voice",
+			Description: "Turn spoken answers to your voice messages on or off",
+			Usage:       "/voice [on|off]",
+			Args:        oneOf("on", "off"),
+			Handler:     b.handleVoiceCommand,
+		},
+		&command{
+			Name:        "weather",
+			Description: "Show the current weather in a city",
+			Usage:       "/weather <city>",
+			Args:        requiredText("Please provide a city name. Example: /weather London"),
+			Middleware:  []middleware{b.chatAction(tgbotapi.ChatTyping)},
+			Handler:     b.handleWeatherCommand,
+		},
+		&command{
+			Name:        "pitch",
+			Description: "Get a short pitch deck for a startup idea",
+			Usage:       "/pitch <idea>",
+			Args:        requiredText("Please provide your startup idea. Example: /pitch AI tool for lawyers"),
+			Middleware:  []middleware{b.rateLimited, b.chatAction(tgbotapi.ChatTyping)},
+			Handler:     b.handlePitchCommand,
+		},
+		&command{
+			Name:        "photo",
+			Description: "Show a photo of a topic from Unsplash",
+			Usage:       "/photo <topic>",
+			Args:        requiredText("Please tell me what to look for."),
+			Middleware:  []middleware{b.chatAction(tgbotapi.ChatUploadPhoto)},
+			Handler:     b.handlePhotoCommand,
+		},
+		&command{
+			Name:        "image",
+			Description: "Generate an image of a topic",
+			Usage:       "/image <description>",
+			Args:        requiredText("Please describe the image to generate."),
+			Middleware:  []middleware{b.rateLimited, b.chatAction(tgbotapi.ChatUploadPhoto)},
+			Handler:     b.handleImageCommand,
+		},
+		&command{
+			Name:        "doc",
+			Description: "Show the document your questions are answered from",
+			Usage:       "/doc [close]",
+			Args:        oneOf("close"),
+			Handler: func(ctx context.Context, message *tgbotapi.Message, args string) {
+				b.handleDocCommand(ctx, message.Chat.ID, args)
+			},
+		},
+		&command{
+			Name:        "docs",
+			Description: "List your documents to use, summarize again or delete them",
+			Middleware:  []middleware{b.privateOnly},
+			Handler:     b.handleDocsCommand,
+		},
+		&command{
+			Name:        "settings",
+			Description: "Show or change this chat's language, persona and commands",
+			Usage:       "/settings [language|persona|enable|disable] <value>",
+			Required:    true,
+			Handler:     b.handleSettingsCommand,
+		},
+		&command{
+			Name:        "admin",
+			Description: "Admin tools: stats, users, bans, quotas and broadcasts",
+			Usage:       "/admin <stats|user|ban|unban|quota|broadcast|broadcasts|cancel>",
+			Role:        models.RoleAdmin,
+			Required:    true,
+			Handler:     b.handleAdminCommand,
+		},
+	)
+
+	return r
+}
+
+func (b *Bot) handleStartCommand(ctx context.Context, message *tgbotapi.Message, _ string) {
+	firstName := message.From.FirstName
+	if user := userFrom(ctx); user != nil {
+		firstName = user.FirstName
+	}
+
+	welcomeMsg := fmt.Sprintf(`Hello %s! Welcome to Newton AI Bot! 
+
+
+use /help to see all available commands
+
+Just send me any message and I'll respond using AI!`, firstName)
+
+	b.sendMessage(message.Chat.ID, welcomeMsg)
+}
+
+func (b *Bot) handleHelpCommand(ctx context.Context, message *tgbotapi.Message, _ string) {
+	settings, err := b.chatSettings(ctx, message.Chat.ID)
+	if err != nil {
+		slog.Error("failed to load chat settings", "chat_id", message.Chat.ID, "error", err)
+		b.sendMessage(message.Chat.ID, settingsUnavailable)
+		return
+	}
+	b.sendText(message.Chat.ID, b.router.help(b.roleOf(ctx, message.From.ID), settings.DisabledCommands))
+}
+
+func (b *Bot) handleClearCommand(ctx context.Context, message *tgbotapi.Message, _ string) {
+	chatID := message.Chat.ID
+
+	if err := b.convRepo.Clear(ctx, chatID); err != nil {
+		slog.Error("failed to clear conversation", "chat_id", chatID, "error", err)
+		b.sendMessage(chatID, "Sorry, couldn't clear conversation history right now.")
+		return
+	}
+	b.sendMessage(chatID, "Conversation history cleared!")
+}
+
+func (b *Bot) handleWeatherCommand(ctx context.Context, message *tgbotapi.Message, city string) {
+	chatID := message.Chat.ID
+
+	weatherInfo, err := handlers.GetWeather(ctx, city)
+	if err != nil {
+		slog.Error("weather request failed", "chat_id", chatID, "command", "weather", "error", err)
+		b.sendMessage(chatID, "Sorry, I couldn't fetch the weather right now.")
+		return
+	}
+
+	b.sendMessage(chatID, weatherInfo)
+}
+
+func (b *Bot) handlePitchCommand(ctx context.Context, message *tgbotapi.Message, idea string) {
+	chatID := message.Chat.ID
+
+	sent, err := b.sendPlaceholder(chatID, replyTarget(message), "Generating your pitch, please wait...")
+	if err != nil {
+		slog.Error("failed to send placeholder", "chat_id", chatID, "command", "pitch", "error", err)
+	}
+	defer b.releasePlaceholder(chatID, sent.MessageID)
+
+	pitch, err := ai.GeneratePitch(ctx, b.provider, idea)
+	if err != nil {
+		slog.Error("failed to generate pitch", "chat_id", chatID, "command", "pitch", "provider", b.provider.Name(), "error", err)
+		edit := tgbotapi.NewEditMessageText(chatID, sent.MessageID, failureText(ctx, "Sorry, I couldn't generate pitch right now."))
+		b.api.Send(edit)
+		return
+	}
+
+	edit := tgbotapi.NewEditMessageText(chatID, sent.MessageID, pitch)
+	b.api.Send(edit)
+}
+
+func (b *Bot) handlePhotoCommand(ctx context.Context, message *tgbotapi.Message, query string) {
+	chatID := message.Chat.ID
+
+	url, caption, err := handlers.SendUnsplashPhoto(ctx, chatID, query)
+	if err != nil {
+		b.sendMessage(chatID, "can't find photo for now")
+		return
+	}
+
+	msg := tgbotapi.NewPhoto(chatID, tgbotapi.FileURL(url))
+	msg.Caption = caption
+	if _, err := b.api.Send(msg); err != nil {
+		slog.Error("failed to send unsplash photo", "chat_id", chatID, "command", "photo", "error", err)
+	}
+}
+
+func (b *Bot) handleImageCommand(ctx context.Context, message *tgbotapi.Message, prompt string) {
+	chatID := message.Chat.ID
+
+	url, caption, err := handlers.SendAIImage(prompt)
+	if err != nil {
+		b.sendMessage(chatID, "can't generate image for now")
+		return
+	}
+
+	msg := tgbotapi.NewPhoto(chatID, tgbotapi.FileURL(url))
+	msg.Caption = caption
+	if _, err := b.api.Send(msg); err != nil {
+		slog.Error("failed to send generated image", "chat_id", chatID, "command", "image", "error", err)
+		b.sendMessage(chatID, "can't generate image for now")
+	}
+}
@@ -0,0 +1,167 @@
+package telegram
+
+import (
+	"context"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// dispatcher runs updates on a fixed pool of workers sharded by chat ID.
+// All updates of one chat land on the same worker, so they are handled one at a time
+// and in the order Telegram delivered them, while different chats run in parallel
+// with concurrency bounded by the number of workers.
+//
+// Handlers run with ctx; once it is cancelled the updates still queued are passed to
+// skip instead, so the chat can be told to resend rather than waiting for nothing.
+type dispatcher struct {
+	ctx    context.Context
+	queues []chan tgbotapi.Update
+	handle func(context.Context, tgbotapi.Update)
+	skip   func(tgbotapi.Update)
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+func newDispatcher(ctx context.Context, workers, queueSize int, handle func(context.Context, tgbotapi.Update), skip func(tgbotapi.Update)) *dispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+
+	d := &dispatcher{
+		ctx:    ctx,
+		queues: make([]chan tgbotapi.Update, workers),
+		handle: handle,
+		skip:   skip,
+	}
+
+	for i := range d.queues {
+		d.queues[i] = make(chan tgbotapi.Update, queueSize)
+		d.wg.Add(1)
+		go d.work(d.queues[i])
+	}
+
+	return d
+}
+
+func (d *dispatcher) work(queue <-chan tgbotapi.Update) {
+	defer d.wg.Done()
+	for update := range queue {
+		if d.ctx.Err() != nil {
+			d.skip(update)
+			continue
+		}
+		d.handle(d.ctx, update)
+	}
+}
+
+// Dispatch queues an update on its chat's worker without blocking, false when that worker's
+// queue is full so intake keeps running for every other chat
+func (d *dispatcher) Dispatch(update tgbotapi.Update) bool {
+	shard := uint64(updateKey(update)) % uint64(len(d.queues))
+
+	select {
+	case d.queues[shard] <- update:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops accepting updates, queued ones are still processed
+func (d *dispatcher) Close() {
+	d.once.Do(func() {
+		for _, q := range d.queues {
+			close(q)
+		}
+	})
+}
+
+// drain passes the updates still queued after Close to skip, for workers that are stuck in a
+// handler and will never reach them; it returns how many were skipped
+func (d *dispatcher) drain() int {
+	n := 0
+	for _, q := range d.queues {
+		for update := range q {
+			d.skip(update)
+			n++
+		}
+	}
+	return n
+}
+
+// Wait blocks until every worker has finished or ctx expires, reporting whether they finished
+func (d *dispatcher) Wait(ctx context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// updateKey is the chat an update belongs to, falling back to the sender for chat-less updates
+func updateKey(update tgbotapi.Update) int64 {
+	if chat := updateChat(update); chat != nil {
+		return chat.ID
+	}
+	if user := update.SentFrom(); user != nil {
+		return user.ID
+	}
+	return 0
+}
+
+// updateChat is the chat an update came from, nil for chat-less updates
+func updateChat(update tgbotapi.Update) *tgbotapi.Chat {
+	// FromChat dereferences CallbackQuery.Message, which is nil for inline message callbacks
+	if update.CallbackQuery != nil && update.CallbackQuery.Message == nil {
+		return nil
+	}
+	return update.FromChat()
+}
+
+// chatStore is a per-chat value map that is safe for concurrent use
+type chatStore[T any] struct {
+	mu     sync.RWMutex
+	values map[int64]T
+}
+
+func newChatStore[T any]() *chatStore[T] {
+	return &chatStore[T]{values: make(map[int64]T)}
+}
+
+func (s *chatStore[T]) Get(chatID int64) (T, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.values[chatID]
+	return v, ok
+}
+
+func (s *chatStore[T]) Set(chatID int64, v T) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[chatID] = v
+}
+
+func (s *chatStore[T]) Delete(chatID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, chatID)
+}
+
+// DeleteFunc removes the values del returns true for
+func (s *chatStore[T]) DeleteFunc(del func(chatID int64, v T) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for chatID, v := range s.values {
+		if del(chatID, v) {
+			delete(s.values, chatID)
+		}
+	}
+}
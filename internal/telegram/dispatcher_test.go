@@ -0,0 +1,278 @@
+package telegram
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func messageUpdate(id int, chatID int64) tgbotapi.Update {
+	return tgbotapi.Update{
+		UpdateID: id,
+		Message: &tgbotapi.Message{
+			Chat: &tgbotapi.Chat{ID: chatID},
+			From: &tgbotapi.User{ID: chatID},
+		},
+	}
+}
+
+func TestUpdateKey(t *testing.T) {
+	user := &tgbotapi.User{ID: 42}
+	chat := &tgbotapi.Chat{ID: -100}
+
+	tests := []struct {
+		name   string
+		update tgbotapi.Update
+		want   int64
+	}{
+		{"message", tgbotapi.Update{Message: &tgbotapi.Message{Chat: chat, From: user}}, -100},
+		{"edited message", tgbotapi.Update{EditedMessage: &tgbotapi.Message{Chat: chat, From: user}}, -100},
+		{"callback", tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{From: user, Message: &tgbotapi.Message{Chat: chat}}}, -100},
+		{"inline message callback", tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{From: user}}, 42},
+		{"inline query", tgbotapi.Update{InlineQuery: &tgbotapi.InlineQuery{From: user}}, 42},
+		{"chosen inline result", tgbotapi.Update{ChosenInlineResult: &tgbotapi.ChosenInlineResult{From: user}}, 42},
+		{"empty", tgbotapi.Update{}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := updateKey(tt.update); got != tt.want {
+				t.Errorf("updateKey() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDispatcherKeepsChatOrder(t *testing.T) {
+	const (
+		chats   = 8
+		perChat = 200
+	)
+
+	var (
+		mu      sync.Mutex
+		seen    = make(map[int64][]int)
+		running = make(map[int64]bool)
+	)
+	handle := func(_ context.Context, u tgbotapi.Update) {
+		chatID := u.Message.Chat.ID
+
+		mu.Lock()
+		if running[chatID] {
+			t.Errorf("chat %d handled concurrently", chatID)
+		}
+		running[chatID] = true
+		mu.Unlock()
+
+		time.Sleep(10 * time.Microsecond)
+
+		mu.Lock()
+		running[chatID] = false
+		seen[chatID] = append(seen[chatID], u.UpdateID)
+		mu.Unlock()
+	}
+
+	d := newDispatcher(context.Background(), 3, chats*perChat, handle, func(tgbotapi.Update) {
+		t.Error("update skipped without cancellation")
+	})
+
+	for i := 0; i < perChat; i++ {
+		for chat := int64(1); chat <= chats; chat++ {
+			if !d.Dispatch(messageUpdate(i, chat)) {
+				t.Fatalf("update %d of chat %d rejected", i, chat)
+			}
+		}
+	}
+	d.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !d.Wait(ctx) {
+		t.Fatal("workers did not finish")
+	}
+
+	for chat := int64(1); chat <= chats; chat++ {
+		ids := seen[chat]
+		if len(ids) != perChat {
+			t.Fatalf("chat %d: handled %d updates, want %d", chat, len(ids), perChat)
+		}
+		for i, id := range ids {
+			if id != i {
+				t.Fatalf("chat %d: update %d handled at position %d", chat, id, i)
+			}
+		}
+	}
+}
+
+func TestDispatcherRejectsWhenShardFull(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	handle := func(context.Context, tgbotapi.Update) {
+		started <- struct{}{}
+		<-release
+	}
+
+	d := newDispatcher(context.Background(), 1, 1, handle, func(tgbotapi.Update) {})
+
+	if !d.Dispatch(messageUpdate(1, 1)) {
+		t.Fatal("first update rejected")
+	}
+	<-started
+	if !d.Dispatch(messageUpdate(2, 1)) {
+		t.Fatal("update rejected while the queue had room")
+	}
+
+	done := make(chan bool)
+	go func() { done <- d.Dispatch(messageUpdate(3, 2)) }()
+	select {
+	case ok := <-done:
+		if ok {
+			t.Fatal("update accepted by a full queue")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Dispatch blocked on a full queue")
+	}
+
+	close(release)
+	d.Close()
+	if !d.Wait(context.Background()) {
+		t.Fatal("workers did not finish")
+	}
+}
+
+func TestDispatcherWait(t *testing.T) {
+	release := make(chan struct{})
+	d := newDispatcher(context.Background(), 2, 4, func(context.Context, tgbotapi.Update) {
+		<-release
+	}, func(tgbotapi.Update) {})
+
+	d.Dispatch(messageUpdate(1, 1))
+	d.Close()
+	// a second Close must not panic on the closed queues
+	d.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if d.Wait(ctx) {
+		t.Fatal("Wait returned true while a handler was running")
+	}
+
+	close(release)
+	if !d.Wait(context.Background()) {
+		t.Fatal("Wait returned false after the handler finished")
+	}
+}
+
+func TestDispatcherSkipsAfterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	var handled, skipped atomic.Int32
+	handle := func(context.Context, tgbotapi.Update) {
+		if handled.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+	}
+	d := newDispatcher(ctx, 1, 8, handle, func(tgbotapi.Update) { skipped.Add(1) })
+
+	for i := 0; i < 4; i++ {
+		d.Dispatch(messageUpdate(i, 1))
+	}
+	<-started
+	cancel()
+	close(release)
+	d.Close()
+	d.Wait(context.Background())
+
+	if handled.Load() != 1 || skipped.Load() != 3 {
+		t.Fatalf("handled %d and skipped %d updates, want 1 and 3", handled.Load(), skipped.Load())
+	}
+}
+
+func TestChatStoreConcurrentUse(t *testing.T) {
+	s := newChatStore[int]()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				chatID := int64(i % 16)
+				s.Set(chatID, w)
+				s.Get(chatID)
+				if i%7 == 0 {
+					s.Delete(chatID)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	s.Set(1, 10)
+	if v, ok := s.Get(1); !ok || v != 10 {
+		t.Fatalf("Get(1) = %d, %v, want 10, true", v, ok)
+	}
+	s.Delete(1)
+	if _, ok := s.Get(1); ok {
+		t.Fatal("Get(1) found a deleted value")
+	}
+}
+
+func TestDispatcherDrainsStuckQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	var skipped atomic.Int32
+	handle := func(context.Context, tgbotapi.Update) {
+		close(started)
+		// ignores cancellation like a handler stuck in a call without a context
+		<-release
+	}
+	d := newDispatcher(ctx, 1, 8, handle, func(tgbotapi.Update) { skipped.Add(1) })
+
+	for i := 0; i < 4; i++ {
+		d.Dispatch(messageUpdate(i, 1))
+	}
+	<-started
+	d.Close()
+	cancel()
+
+	if n := d.drain(); n != 3 {
+		t.Fatalf("drain() = %d, want 3", n)
+	}
+	if skipped.Load() != 3 {
+		t.Fatalf("skipped %d updates, want 3", skipped.Load())
+	}
+
+	close(release)
+	if !d.Wait(context.Background()) {
+		t.Fatal("worker did not finish")
+	}
+}
+
+func TestChatStoreDeleteFunc(t *testing.T) {
+	s := newChatStore[activeDocument]()
+	s.Set(1, activeDocument{ID: 7})
+	s.Set(2, activeDocument{ID: 8})
+	s.Set(3, activeDocument{ID: 7})
+
+	s.DeleteFunc(func(_ int64, d activeDocument) bool { return d.ID == 7 })
+
+	if _, ok := s.Get(1); ok {
+		t.Error("chat 1 still has the deleted document")
+	}
+	if _, ok := s.Get(3); ok {
+		t.Error("chat 3 still has the deleted document")
+	}
+	if d, ok := s.Get(2); !ok || d.ID != 8 {
+		t.Errorf("Get(2) = %+v, %v, want document 8", d, ok)
+	}
+}
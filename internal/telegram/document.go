@@ -0,0 +1,249 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nurashi/Newton/internal/ai"
+	"github.com/nurashi/Newton/internal/documents"
+	"github.com/nurashi/Newton/internal/models"
+)
+
+const (
+	docChunkSize    = 1200
+	docChunkOverlap = 150
+	// docTopK and docContextChars bound how much of the document goes into each prompt
+	docTopK         = 4
+	docContextChars = 5000
+	// docEmbedBatch is how many chunks are embedded per API call
+	docEmbedBatch = 50
+)
+
+// activeDocument is the uploaded document follow-up questions in a chat are answered from
+type activeDocument struct {
+	ID         int64
+	Name       string
+	Type       string
+	Size       int
+	ChunkCount int
+	Embedded   bool
+}
+
+// activeDocument returns the document a chat's questions are answered from, loaded from the
+// database the first time it's needed since the bot started
+func (b *Bot) activeDocument(ctx context.Context, chatID int64) (activeDocument, bool) {
+	if doc, ok := b.activeDocs.Get(chatID); ok {
+		return doc, true
+	}
+
+	doc, err := b.docRepo.Active(ctx, chatID)
+	if err != nil {
+		slog.Error("failed to load active document", "chat_id", chatID, "error", err)
+		return activeDocument{}, false
+	}
+	if doc == nil {
+		return activeDocument{}, false
+	}
+
+	active := activeFrom(doc)
+	b.activeDocs.Set(chatID, active)
+	return active, true
+}
+
+// setActiveDocument answers a chat's questions from doc from now on
+func (b *Bot) setActiveDocument(ctx context.Context, chatID int64, doc activeDocument) {
+	if err := b.docRepo.SetActive(ctx, chatID, doc.ID); err != nil {
+		// the chat still uses it until the bot restarts
+		slog.Error("failed to save active document", "chat_id", chatID, "document_id", doc.ID, "error", err)
+	}
+	b.activeDocs.Set(chatID, doc)
+}
+
+// clearActiveDocument stops answering a chat's questions from a document
+func (b *Bot) clearActiveDocument(ctx context.Context, chatID int64) {
+	if err := b.docRepo.ClearActive(ctx, chatID); err != nil {
+		slog.Error("failed to clear active document", "chat_id", chatID, "error", err)
+	}
+	b.activeDocs.Delete(chatID)
+}
+
+// ingestDocument chunks and embeds the extracted sections and stores them in the user's library.
+// The sections are chunked as extracted, their joined text is only kept to create the guide again.
+func (b *Bot) ingestDocument(ctx context.Context, chatID, userID int64, filename, fileID, fileType string, sections []documents.Section) (activeDocument, error) {
+	text := documents.Join(sections)
+	chunks := documents.SplitSections(sections, docChunkSize, docChunkOverlap)
+	if len(chunks) == 0 {
+		return activeDocument{}, fmt.Errorf("document has no text")
+	}
+
+	embedded := b.embedChunks(ctx, chunks)
+
+	stored := make([]models.DocumentChunk, 0, len(chunks))
+	for _, c := range chunks {
+		sc := models.DocumentChunk{ChunkIndex: c.Index, Content: c.Text}
+		if c.Location != "" {
+			location := c.Location
+			sc.Location = &location
+		}
+		if embedded {
+			model := b.embedder.Model()
+			sc.Embedding = c.Embedding
+			sc.EmbeddingModel = &model
+		}
+		stored = append(stored, sc)
+	}
+
+	doc, err := b.docRepo.Create(ctx, models.Document{
+		ChatID:    chatID,
+		UserID:    &userID,
+		Filename:  filename,
+		FileType:  fileType,
+		CharCount: utf8.RuneCountInString(text),
+		FileID:    &fileID,
+		Content:   text,
+	}, stored)
+	if err != nil {
+		return activeDocument{}, err
+	}
+
+	return activeFrom(doc), nil
+}
+
+// embedChunks fills chunk embeddings in place, false when embeddings are disabled or failed
+func (b *Bot) embedChunks(ctx context.Context, chunks []documents.Chunk) bool {
+	if b.embedder == nil {
+		return false
+	}
+
+	for start := 0; start < len(chunks); start += docEmbedBatch {
+		end := min(start+docEmbedBatch, len(chunks))
+
+		texts := make([]string, 0, end-start)
+		for _, c := range chunks[start:end] {
+			texts = append(texts, c.Text)
+		}
+
+		vectors, err := b.embedder.Embed(ctx, texts, ai.EmbedDocument)
+		if err != nil {
+			slog.Warn("failed to embed document chunks, falling back to keyword search", "model", b.embedder.Model(), "error", err)
+			return false
+		}
+
+		for i, v := range vectors {
+			chunks[start+i].Embedding = v
+		}
+	}
+
+	return true
+}
+
+// documentContext returns the system instruction with passages of the chat's document relevant to
+// question, together with the page/slide locations they were taken from
+func (b *Bot) documentContext(ctx context.Context, chatID int64, question string) (string, []string, bool) {
+	doc, ok := b.activeDocument(ctx, chatID)
+	if !ok {
+		return "", nil, false
+	}
+
+	chunks, err := b.retrieveChunks(ctx, doc, question)
+	if err != nil {
+		slog.Error("failed to retrieve document passages", "chat_id", chatID, "document_id", doc.ID, "error", err)
+		return "", nil, false
+	}
+	if len(chunks) == 0 {
+		return "", nil, false
+	}
+
+	passages := make([]ai.Passage, 0, len(chunks))
+	var sources []string
+	for _, c := range chunks {
+		passages = append(passages, ai.Passage{Location: c.Location, Text: c.Text})
+		if c.Location != "" && !slices.Contains(sources, c.Location) {
+			sources = append(sources, c.Location)
+		}
+	}
+
+	return ai.DocumentPrompt(doc.Name, passages), sources, true
+}
+
+// retrieveChunks ranks the stored chunks by embedding similarity, or by keywords when no vectors are usable
+func (b *Bot) retrieveChunks(ctx context.Context, doc activeDocument, question string) ([]documents.Chunk, error) {
+	stored, err := b.docRepo.Chunks(ctx, doc.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := make([]documents.Chunk, 0, len(stored))
+	comparable := b.embedder != nil
+	for _, sc := range stored {
+		c := documents.Chunk{Index: sc.ChunkIndex, Text: sc.Content, Embedding: sc.Embedding}
+		if sc.Location != nil {
+			c.Location = *sc.Location
+		}
+		if sc.EmbeddingModel == nil || b.embedder == nil || *sc.EmbeddingModel != b.embedder.Model() {
+			comparable = false
+		}
+		chunks = append(chunks, c)
+	}
+
+	if comparable {
+		vectors, err := b.embedder.Embed(ctx, []string{question}, ai.EmbedQuery)
+		if err == nil && len(vectors) == 1 {
+			return documents.TopChunksByEmbedding(chunks, vectors[0], docTopK, docContextChars), nil
+		}
+		slog.Warn("failed to embed question, falling back to keyword search", "document_id", doc.ID, "error", err)
+	}
+
+	return documents.TopChunks(chunks, question, docTopK, docContextChars), nil
+}
+
+// sourcesFooter renders the locations an answer was grounded in
+func sourcesFooter(sources []string) string {
+	if len(sources) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n\n_Sources: %s_", strings.Join(sources, ", "))
+}
+
+// handleDocCommand shows the active document, "/doc close" drops it
+func (b *Bot) handleDocCommand(ctx context.Context, chatID int64, args string) {
+	doc, ok := b.activeDocument(ctx, chatID)
+
+	switch strings.TrimSpace(strings.ToLower(args)) {
+	case "":
+		if !ok {
+			b.sendMessage(chatID, "No active document. Send me a document (PDF, DOCX, EPUB, spreadsheet and more) to start asking questions about it.")
+			return
+		}
+
+		search := "keyword"
+		if doc.Embedded {
+			search = "semantic"
+		}
+
+		b.sendPlainMessage(chatID, fmt.Sprintf(`Active document
+
+Name: %s
+Type: %s
+Size: %d characters (%d passages, %s search)
+
+Your questions are answered using this document. Use /doc close to stop or /docs to switch to another one.`,
+			doc.Name, doc.Type, doc.Size, doc.ChunkCount, search))
+
+	case "close":
+		if !ok {
+			b.sendMessage(chatID, "No active document to close.")
+			return
+		}
+
+		b.clearActiveDocument(ctx, chatID)
+		b.sendPlainMessage(chatID, fmt.Sprintf("Closed %s. I'll answer without it from now on.", doc.Name))
+
+	default:
+		b.sendMessage(chatID, "Usage: /doc - show the active document, /doc close - stop using it")
+	}
+}
@@ -0,0 +1,338 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nurashi/Newton/internal/ai"
+	"github.com/nurashi/Newton/internal/models"
+)
+
+const (
+	maxLanguageLength = 32
+	maxPersonaLength  = 500
+)
+
+// isGroup reports whether chat is shared by several users
+func isGroup(chat *tgbotapi.Chat) bool {
+	return chat != nil && (chat.IsGroup() || chat.IsSuperGroup())
+}
+
+// mentionPattern matches "@username" of the bot anywhere in a text
+func mentionPattern(username string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)@` + regexp.QuoteMeta(username) + `\b`)
+}
+
+// addressed reports whether a group message is meant for the bot: a command with
+// the bot's @suffix, a reply to one of its messages or a mention
+func (b *Bot) addressed(message *tgbotapi.Message) bool {
+	if message.IsCommand() {
+		_, at, found := strings.Cut(message.CommandWithAt(), "@")
+		return found && strings.EqualFold(at, b.api.Self.UserName)
+	}
+
+	if reply := message.ReplyToMessage; reply != nil && reply.From != nil && reply.From.ID == b.api.Self.ID {
+		return true
+	}
+
+	return b.mentioned(message.Text, message.Entities) || b.mentioned(message.Caption, message.CaptionEntities)
+}
+
+func (b *Bot) mentioned(text string, entities []tgbotapi.MessageEntity) bool {
+	for _, e := range entities {
+		if e.Type == "text_mention" && e.User != nil && e.User.ID == b.api.Self.ID {
+			return true
+		}
+	}
+	return b.mention.MatchString(text)
+}
+
+// stripMention removes the bot's @username from a prompt
+func (b *Bot) stripMention(text string) string {
+	return strings.TrimSpace(b.mention.ReplaceAllString(text, ""))
+}
+
+// replyTarget is the message answers should reply to, in groups it's the triggering message
+func replyTarget(message *tgbotapi.Message) int {
+	if isGroup(message.Chat) {
+		return message.MessageID
+	}
+	return 0
+}
+
+// isChatAdmin reports whether userID may change the chat's settings, bot admins always can
+func (b *Bot) isChatAdmin(ctx context.Context, chat *tgbotapi.Chat, userID int64) bool {
+	if !isGroup(chat) || b.isAdmin(ctx, userID) {
+		return true
+	}
+
+	member, err := b.api.GetChatMember(tgbotapi.GetChatMemberConfig{
+		ChatConfigWithUser: tgbotapi.ChatConfigWithUser{ChatID: chat.ID, UserID: userID},
+	})
+	if err != nil {
+		slog.Error("failed to get chat member", "chat_id", chat.ID, "user_id", userID, "error", err)
+		return false
+	}
+
+	return member.IsCreator() || member.IsAdministrator()
+}
+
+// groupAdmin limits a command to the chat's admins when it's used in a group
+func (b *Bot) groupAdmin(cmd *command, next commandFunc) commandFunc {
+	return func(ctx context.Context, message *tgbotapi.Message, args string) {
+		if !b.isChatAdmin(ctx, message.Chat, message.From.ID) {
+			b.sendMessage(message.Chat.ID, fmt.Sprintf("Only group admins can use /%s here.", cmd.Name))
+			return
+		}
+
+		next(ctx, message, args)
+	}
+}
+
+// privateOnly refuses a command in groups, for commands that show a user's private data
+func (b *Bot) privateOnly(cmd *command, next commandFunc) commandFunc {
+	return func(ctx context.Context, message *tgbotapi.Message, args string) {
+		if isGroup(message.Chat) {
+			b.sendText(message.Chat.ID, fmt.Sprintf("/%s shows your private data, use it in a private chat with me: https://t.me/%s", cmd.Name, b.api.Self.UserName))
+			return
+		}
+
+		next(ctx, message, args)
+	}
+}
+
+// commandEnabled refuses commands the chat's admins have disabled
+func (b *Bot) commandEnabled(cmd *command, next commandFunc) commandFunc {
+	if cmd.Required {
+		return next
+	}
+
+	return func(ctx context.Context, message *tgbotapi.Message, args string) {
+		settings, err := b.chatSettings(ctx, message.Chat.ID)
+		if err != nil {
+			slog.Error("failed to load chat settings", "chat_id", message.Chat.ID, "command", cmd.Name, "error", err)
+			b.sendMessage(message.Chat.ID, settingsUnavailable)
+			return
+		}
+		if slices.Contains(settings.DisabledCommands, cmd.Name) {
+			b.sendMessage(message.Chat.ID, fmt.Sprintf("/%s is disabled in this chat.", cmd.Name))
+			return
+		}
+
+		next(ctx, message, args)
+	}
+}
+
+const (
+	// settingsTTL is how long chat settings are cached, changes made by another instance show up after it
+	settingsTTL = 10 * time.Minute
+	// maxCachedSettings bounds the settings cache, the least recently loaded chats are dropped first
+	maxCachedSettings = 10000
+)
+
+// settingsUnavailable answers requests that need a chat's settings while they can't be loaded
+const settingsUnavailable = "Sorry, couldn't load this chat's settings right now. Please try again later."
+
+// settingsCache keeps the settings of recently active chats for settingsTTL. Expired entries
+// stay until they are evicted, so they can still stand in when the database is unavailable.
+type settingsCache struct {
+	mu      sync.Mutex
+	entries map[int64]cachedSettings
+}
+
+type cachedSettings struct {
+	settings *models.ChatSettings
+	loaded   time.Time
+}
+
+func newSettingsCache() *settingsCache {
+	return &settingsCache{entries: make(map[int64]cachedSettings)}
+}
+
+// get returns the cached settings of a chat, fresh is false once they are older than settingsTTL
+func (c *settingsCache) get(chatID int64) (settings *models.ChatSettings, fresh, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[chatID]
+	if !ok {
+		return nil, false, false
+	}
+	return e.settings, time.Since(e.loaded) < settingsTTL, true
+}
+
+func (c *settingsCache) set(chatID int64, settings *models.ChatSettings) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[chatID]; !ok && len(c.entries) >= maxCachedSettings {
+		c.evict()
+	}
+	c.entries[chatID] = cachedSettings{settings: settings, loaded: time.Now()}
+}
+
+// evict drops the expired entries, or the oldest one when none has expired
+func (c *settingsCache) evict() {
+	var oldest int64
+	var oldestLoaded time.Time
+	evicted := false
+	for chatID, e := range c.entries {
+		if time.Since(e.loaded) >= settingsTTL {
+			delete(c.entries, chatID)
+			evicted = true
+			continue
+		}
+		if oldestLoaded.IsZero() || e.loaded.Before(oldestLoaded) {
+			oldest, oldestLoaded = chatID, e.loaded
+		}
+	}
+	if !evicted {
+		delete(c.entries, oldest)
+	}
+}
+
+// chatSettings returns the settings of a chat, cached for settingsTTL. When they can't be loaded
+// the last cached value is used, without one the error is returned so callers refuse rather than
+// run with defaults that would ignore e.g. disabled commands.
+func (b *Bot) chatSettings(ctx context.Context, chatID int64) (*models.ChatSettings, error) {
+	cached, fresh, ok := b.settings.get(chatID)
+	if fresh {
+		return cached, nil
+	}
+
+	settings, err := b.settingsRepo.Get(ctx, chatID)
+	if err != nil {
+		if ok {
+			slog.Warn("failed to reload chat settings, using cached ones", "chat_id", chatID, "error", err)
+			return cached, nil
+		}
+		return nil, err
+	}
+
+	b.settings.set(chatID, settings)
+	return settings, nil
+}
+
+// systemPrompt is the chat instruction adjusted to the chat's settings
+func systemPrompt(settings *models.ChatSettings, group bool) string {
+	prompt := ai.SystemPrompt
+	if group {
+		prompt += " You are in a group chat, each user message starts with the sender's name."
+	}
+	if settings.Persona != nil {
+		prompt += " Your persona: " + *settings.Persona
+	}
+	if settings.Language != nil {
+		prompt += " Always answer in " + *settings.Language + "."
+	}
+	return prompt
+}
+
+func (b *Bot) handleSettingsCommand(ctx context.Context, message *tgbotapi.Message, args string) {
+	chatID := message.Chat.ID
+	current, err := b.chatSettings(ctx, chatID)
+	if err != nil {
+		slog.Error("failed to load chat settings", "chat_id", chatID, "error", err)
+		b.sendMessage(chatID, settingsUnavailable)
+		return
+	}
+
+	action, value, _ := strings.Cut(strings.TrimSpace(args), " ")
+	action = strings.ToLower(action)
+	value = strings.TrimSpace(value)
+
+	if action == "" {
+		b.sendText(chatID, b.formatSettings(current))
+		return
+	}
+
+	if !b.isChatAdmin(ctx, message.Chat, message.From.ID) {
+		b.sendMessage(chatID, "Only group admins can change the settings.")
+		return
+	}
+
+	settings := *current
+	settings.DisabledCommands = slices.Clone(current.DisabledCommands)
+
+	switch action {
+	case "language", "persona":
+		limit, field := maxLanguageLength, &settings.Language
+		if action == "persona" {
+			limit, field = maxPersonaLength, &settings.Persona
+		}
+		switch {
+		case value == "":
+			b.sendText(chatID, fmt.Sprintf("Usage: /settings %s <value|off>", action))
+			return
+		case strings.EqualFold(value, "off"):
+			*field = nil
+		case len([]rune(value)) > limit:
+			b.sendText(chatID, fmt.Sprintf("The %s can be at most %d characters.", action, limit))
+			return
+		default:
+			*field = &value
+		}
+	case "enable", "disable":
+		name := strings.ToLower(strings.TrimPrefix(value, "/"))
+		cmd, ok := b.router.lookup(name)
+		if !ok {
+			b.sendText(chatID, fmt.Sprintf("Unknown command %q.", value))
+			return
+		}
+		if cmd.Required {
+			b.sendText(chatID, fmt.Sprintf("/%s can't be disabled.", cmd.Name))
+			return
+		}
+		settings.DisabledCommands = slices.DeleteFunc(settings.DisabledCommands, func(c string) bool { return c == cmd.Name })
+		if action == "disable" {
+			settings.DisabledCommands = append(settings.DisabledCommands, cmd.Name)
+		}
+	default:
+		b.sendText(chatID, fmt.Sprintf("Unknown setting %q.\nUsage: /settings [language|persona|enable|disable] <value>", action))
+		return
+	}
+
+	userID := message.From.ID
+	settings.UpdatedBy = &userID
+	if err := b.settingsRepo.Save(ctx, settings); err != nil {
+		slog.Error("failed to save chat settings", "chat_id", chatID, "user_id", userID, "error", err)
+		b.sendMessage(chatID, "Sorry, couldn't save the settings right now.")
+		return
+	}
+	b.settings.set(chatID, &settings)
+
+	slog.Info("chat settings changed", "chat_id", chatID, "user_id", userID, "setting", action)
+	b.sendText(chatID, b.formatSettings(&settings))
+}
+
+func (b *Bot) formatSettings(settings *models.ChatSettings) string {
+	language, persona := "default", "default"
+	if settings.Language != nil {
+		language = *settings.Language
+	}
+	if settings.Persona != nil {
+		persona = *settings.Persona
+	}
+	disabled := "none"
+	if len(settings.DisabledCommands) > 0 {
+		disabled = "/" + strings.Join(settings.DisabledCommands, ", /")
+	}
+
+	return fmt.Sprintf(`Chat settings:
+Language: %s
+Persona: %s
+Disabled commands: %s
+
+Admins can change them with:
+/settings language <language|off>
+/settings persona <description|off>
+/settings disable <command>
+/settings enable <command>`, language, persona, disabled)
+}
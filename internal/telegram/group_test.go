@@ -0,0 +1,36 @@
+package telegram
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nurashi/Newton/internal/models"
+)
+
+func TestSettingsCacheExpiresAndStaysBounded(t *testing.T) {
+	c := newSettingsCache()
+
+	c.set(1, &models.ChatSettings{ChatID: 1})
+	if s, fresh, ok := c.get(1); !ok || !fresh || s.ChatID != 1 {
+		t.Fatalf("get(1) = %v, %v, %v, want fresh settings", s, fresh, ok)
+	}
+
+	// an expired entry is still returned, marked stale, as fallback for a failing database
+	c.entries[1] = cachedSettings{settings: c.entries[1].settings, loaded: time.Now().Add(-settingsTTL)}
+	if _, fresh, ok := c.get(1); !ok || fresh {
+		t.Fatalf("get(1) fresh = %v, ok = %v, want a stale entry", fresh, ok)
+	}
+
+	for id := int64(2); id <= maxCachedSettings+10; id++ {
+		c.set(id, &models.ChatSettings{ChatID: id})
+	}
+	if n := len(c.entries); n > maxCachedSettings {
+		t.Fatalf("cache holds %d entries, want at most %d", n, maxCachedSettings)
+	}
+	if _, _, ok := c.get(1); ok {
+		t.Fatal("expired entry survived eviction")
+	}
+	if _, _, ok := c.get(maxCachedSettings + 10); !ok {
+		t.Fatal("newest entry was evicted")
+	}
+}
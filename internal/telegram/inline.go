@@ -0,0 +1,251 @@
+package telegram
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nurashi/Newton/internal/ai"
+	"github.com/nurashi/Newton/internal/handlers"
+	"github.com/nurashi/Newton/internal/models"
+)
+
+const (
+	// inlineDebounce is how long a user must stop typing before their query is answered
+	inlineDebounce = 700 * time.Millisecond
+	// inlineTimeout keeps answers within the time Telegram accepts them
+	inlineTimeout  = 8 * time.Second
+	inlineCacheTTL = 10 * time.Minute
+	inlineCacheMax = 1000
+	// inlineCacheTime is how long Telegram may serve an answer from its own cache, in seconds
+	inlineCacheTime = 300
+	// maxInlineText is the message length limit of Telegram
+	maxInlineText = 4096
+)
+
+// inlineQueries debounces inline queries per user and caches the answers
+type inlineQueries struct {
+	mu      sync.Mutex
+	pending map[int64]*time.Timer
+	cache   map[string]inlineAnswer
+	wg      sync.WaitGroup
+	stopped bool
+}
+
+type inlineAnswer struct {
+	results []any
+	expires time.Time
+}
+
+func newInlineQueries() *inlineQueries {
+	return &inlineQueries{pending: make(map[int64]*time.Timer), cache: make(map[string]inlineAnswer)}
+}
+
+// debounce runs answer after inlineDebounce unless the user sends a newer query first,
+// queries arriving after stop are dropped
+func (q *inlineQueries) debounce(userID int64, answer func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.stopped {
+		return
+	}
+
+	if t, ok := q.pending[userID]; ok && t.Stop() {
+		q.wg.Done()
+	}
+
+	q.wg.Add(1)
+	var t *time.Timer
+	t = time.AfterFunc(inlineDebounce, func() {
+		defer q.wg.Done()
+
+		q.mu.Lock()
+		if q.pending[userID] == t {
+			delete(q.pending, userID)
+		}
+		q.mu.Unlock()
+
+		answer()
+	})
+	q.pending[userID] = t
+}
+
+// stop drops the queries still waiting and waits for the ones being answered
+func (q *inlineQueries) stop() {
+	q.mu.Lock()
+	q.stopped = true
+	for userID, t := range q.pending {
+		if t.Stop() {
+			q.wg.Done()
+		}
+		delete(q.pending, userID)
+	}
+	q.mu.Unlock()
+
+	q.wg.Wait()
+}
+
+func (q *inlineQueries) cached(key string) ([]any, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	answer, ok := q.cache[key]
+	if !ok || time.Now().After(answer.expires) {
+		return nil, false
+	}
+	return answer.results, true
+}
+
+func (q *inlineQueries) store(key string, results []any) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	if len(q.cache) >= inlineCacheMax {
+		for k, answer := range q.cache {
+			if now.After(answer.expires) {
+				delete(q.cache, k)
+			}
+		}
+	}
+	if len(q.cache) >= inlineCacheMax {
+		clear(q.cache)
+	}
+
+	q.cache[key] = inlineAnswer{results: results, expires: now.Add(inlineCacheTTL)}
+}
+
+// inlineResultID identifies a result by its kind and query, Telegram allows up to 64 bytes
+func inlineResultID(kind, query string) string {
+	sum := sha1.Sum([]byte(strings.ToLower(query)))
+	return kind + ":" + hex.EncodeToString(sum[:12])
+}
+
+// handleInlineQuery answers "@bot <question>", "@bot weather <city>" and "@bot photo <topic>"
+func (b *Bot) handleInlineQuery(ctx context.Context, query *tgbotapi.InlineQuery) {
+	ctx, ok := b.identify(ctx, query.From, query.From.ID)
+	if !ok {
+		return
+	}
+
+	b.inline.debounce(query.From.ID, func() {
+		defer b.recoverUpdate(ctx, tgbotapi.Update{InlineQuery: query})
+		b.answerInlineQuery(ctx, query)
+	})
+}
+
+func (b *Bot) answerInlineQuery(ctx context.Context, query *tgbotapi.InlineQuery) {
+	text := strings.TrimSpace(query.Query)
+	answer := tgbotapi.InlineConfig{InlineQueryID: query.ID, Results: []any{}}
+
+	if text == "" {
+		answer.SwitchPMText = "Ask me anything, or try weather <city> and photo <topic>"
+		answer.SwitchPMParameter = "inline"
+		b.sendInlineAnswer(answer)
+		return
+	}
+
+	key := strings.ToLower(text)
+	if results, ok := b.inline.cached(key); ok {
+		slog.Debug("inline query answered from cache", "user_id", query.From.ID)
+		answer.Results = results
+		answer.CacheTime = inlineCacheTime
+		b.sendInlineAnswer(answer)
+		return
+	}
+
+	start := time.Now()
+	results, cacheable := b.inlineResults(ctx, query.From.ID, text)
+	slog.Info("inline query answered", "user_id", query.From.ID, "results", len(results), "latency_ms", time.Since(start).Milliseconds())
+
+	answer.Results = results
+	if cacheable {
+		b.inline.store(key, results)
+		answer.CacheTime = inlineCacheTime
+	} else {
+		answer.IsPersonal = true
+	}
+	b.sendInlineAnswer(answer)
+}
+
+// inlineResults builds the results for query, false when they must not be cached
+func (b *Bot) inlineResults(ctx context.Context, userID int64, query string) ([]any, bool) {
+	ctx, cancel := context.WithTimeout(ctx, inlineTimeout)
+	defer cancel()
+
+	verb, arg, _ := strings.Cut(query, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch {
+	case strings.EqualFold(verb, models.InlineWeather) && arg != "":
+		weather, err := handlers.GetWeather(ctx, arg)
+		if err != nil {
+			slog.Error("inline weather request failed", "user_id", userID, "error", err)
+			return []any{inlineNotice("Couldn't fetch the weather right now.")}, false
+		}
+		article := tgbotapi.NewInlineQueryResultArticle(inlineResultID(models.InlineWeather, arg), "Weather in "+arg, weather)
+		article.Description = strings.TrimSpace(weather)
+		return []any{article}, true
+
+	case strings.EqualFold(verb, models.InlinePhoto) && arg != "":
+		url, caption, err := handlers.SendUnsplashPhoto(ctx, userID, arg)
+		if err != nil {
+			slog.Error("inline photo request failed", "user_id", userID, "error", err)
+			return []any{inlineNotice("Couldn't find a photo right now.")}, false
+		}
+		photo := tgbotapi.NewInlineQueryResultPhotoWithThumb(inlineResultID(models.InlinePhoto, arg), url, url)
+		photo.Caption = strings.TrimSpace(caption)
+		return []any{photo}, true
+	}
+
+	if refusal := b.aiRefusal(ctx, userID, userID); refusal != "" {
+		return []any{inlineNotice(refusal)}, false
+	}
+
+	ctx, meter := ai.WithMeter(ctx)
+	defer b.recordUsage(ctx, userID, meter)
+
+	resp, err := b.provider.Chat(ctx, ai.WithSystemPrompt(ai.SystemPrompt, []ai.Message{{Role: ai.RoleUser, Content: query}}))
+	if err != nil {
+		slog.Error("inline AI request failed", "user_id", userID, "provider", b.provider.Name(), "model", b.provider.Model(), "error", err)
+		return []any{inlineNotice("Couldn't answer in time, keep typing or try again.")}, false
+	}
+
+	text := truncate(fmt.Sprintf("❓ %s\n\n%s", query, resp.Text), maxInlineText-1)
+	article := tgbotapi.NewInlineQueryResultArticle(inlineResultID(models.InlineAI, query), truncate(query, 64), text)
+	article.Description = truncate(resp.Text, 120)
+	return []any{article}, true
+}
+
+// inlineNotice is a result telling the user why there is no answer
+func inlineNotice(text string) tgbotapi.InlineQueryResultArticle {
+	return tgbotapi.NewInlineQueryResultArticle(inlineResultID("notice", text), text, text)
+}
+
+func (b *Bot) sendInlineAnswer(answer tgbotapi.InlineConfig) {
+	if _, err := b.api.Request(answer); err != nil {
+		slog.Error("failed to answer inline query", "error", err)
+	}
+}
+
+// handleChosenInlineResult records which inline results are sent, it needs inline feedback enabled in @BotFather
+func (b *Bot) handleChosenInlineResult(ctx context.Context, chosen *tgbotapi.ChosenInlineResult) {
+	kind, _, _ := strings.Cut(chosen.ResultID, ":")
+
+	err := b.inlineRepo.RecordChoice(ctx, models.InlineChoice{
+		UserID:   chosen.From.ID,
+		ResultID: chosen.ResultID,
+		Kind:     kind,
+		Query:    chosen.Query,
+	})
+	if err != nil {
+		slog.Error("failed to record inline choice", "user_id", chosen.From.ID, "error", err)
+	}
+}
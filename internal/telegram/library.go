@@ -0,0 +1,249 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nurashi/Newton/internal/ai"
+	"github.com/nurashi/Newton/internal/models"
+)
+
+// docsListSize is how many documents /docs shows, the buttons of more wouldn't fit one message
+const docsListSize = 25
+
+// docsActionPrefix marks the callback data of the buttons under the /docs list, "docs:<action>:<id>"
+const docsActionPrefix = "docs:"
+
+const (
+	docsUse    = "use"
+	docsGuide  = "guide"
+	docsDelete = "delete"
+)
+
+// activeFrom turns a stored document into the chat's active document
+func activeFrom(doc *models.Document) activeDocument {
+	return activeDocument{
+		ID:         doc.ID,
+		Name:       doc.Filename,
+		Type:       doc.FileType,
+		Size:       doc.CharCount,
+		ChunkCount: doc.ChunkCount,
+		Embedded:   doc.Embedded,
+	}
+}
+
+// libraryRefusal explains why a document of chars characters can't be added to the user's library,
+// empty when it fits; chars 0 only checks the number of documents
+func (b *Bot) libraryRefusal(ctx context.Context, userID int64, chars int) string {
+	limits := b.limits
+	if limits.Documents <= 0 && limits.DocumentChars <= 0 {
+		return ""
+	}
+
+	count, used, err := b.docRepo.Usage(ctx, userID)
+	if err != nil {
+		slog.Error("failed to get document usage", "user_id", userID, "error", err)
+		return ""
+	}
+
+	if limits.Documents > 0 && count >= limits.Documents {
+		return fmt.Sprintf("📚 Your library is full (%d of %d documents). Delete some with /docs to add new ones.", count, limits.Documents)
+	}
+	if limits.DocumentChars > 0 && used+int64(chars) > limits.DocumentChars {
+		return fmt.Sprintf("📚 This document doesn't fit in your library (%d of %d characters used, it has %d). Delete some with /docs to make room.", used, limits.DocumentChars, chars)
+	}
+	return ""
+}
+
+func (b *Bot) handleDocsCommand(ctx context.Context, message *tgbotapi.Message, _ string) {
+	chatID, userID := message.Chat.ID, message.From.ID
+
+	text, markup, err := b.library(ctx, chatID, userID)
+	if err != nil {
+		slog.Error("failed to list documents", "chat_id", chatID, "user_id", userID, "error", err)
+		b.sendMessage(chatID, "Sorry, couldn't load your documents right now.")
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	if markup != nil {
+		msg.ReplyMarkup = *markup
+	}
+	if _, err := b.api.Send(msg); err != nil {
+		slog.Error("failed to send document list", "chat_id", chatID, "error", err)
+	}
+}
+
+// library renders the user's documents with a row of buttons for each, markup is nil for an empty library
+func (b *Bot) library(ctx context.Context, chatID, userID int64) (string, *tgbotapi.InlineKeyboardMarkup, error) {
+	count, used, err := b.docRepo.Usage(ctx, userID)
+	if err != nil {
+		return "", nil, err
+	}
+	docs, err := b.docRepo.ListByUser(ctx, userID, docsListSize)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(docs) == 0 {
+		return "Your library is empty. Send me a document (PDF, DOCX, EPUB, spreadsheet and more) to add it.", nil, nil
+	}
+
+	active, _ := b.activeDocument(ctx, chatID)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Your documents (%d", count))
+	if limit := b.limits.Documents; limit > 0 {
+		sb.WriteString(fmt.Sprintf(" of %d", limit))
+	}
+	sb.WriteString(fmt.Sprintf(", %d", used))
+	if limit := b.limits.DocumentChars; limit > 0 {
+		sb.WriteString(fmt.Sprintf(" of %d", limit))
+	}
+	sb.WriteString(" characters)\n\n")
+
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(docs))
+	for i, d := range docs {
+		sb.WriteString(fmt.Sprintf("%d. %s - %s, %d characters, %s", i+1, d.Filename, d.FileType, d.CharCount, d.CreatedAt.Format("2006-01-02")))
+		if d.ID == active.ID {
+			sb.WriteString(" (active)")
+		}
+		sb.WriteString("\n")
+
+		data := func(action string) string {
+			return fmt.Sprintf("%s%s:%d", docsActionPrefix, action, d.ID)
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d ▶️ Use", i+1), data(docsUse)),
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d 🎓 Guide", i+1), data(docsGuide)),
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d 🗑 Delete", i+1), data(docsDelete)),
+		))
+	}
+	if count > len(docs) {
+		sb.WriteString(fmt.Sprintf("...and %d older ones\n", count-len(docs)))
+	}
+	sb.WriteString("\nUse a document to answer questions from it, create its guide again or delete it.")
+
+	markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return sb.String(), &markup, nil
+}
+
+// refreshLibrary updates a /docs list after a button changed the library
+func (b *Bot) refreshLibrary(ctx context.Context, chatID int64, messageID int, userID int64) {
+	text, markup, err := b.library(ctx, chatID, userID)
+	if err != nil {
+		slog.Error("failed to list documents", "chat_id", chatID, "user_id", userID, "error", err)
+		return
+	}
+
+	edit := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	edit.ReplyMarkup = markup
+	if _, err := b.api.Send(edit); err != nil {
+		slog.Debug("failed to refresh document list", "chat_id", chatID, "error", err)
+	}
+}
+
+// handleDocsCallback runs a button of the /docs list, only the owner of a document can press its buttons
+func (b *Bot) handleDocsCallback(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	action, rawID, _ := strings.Cut(strings.TrimPrefix(query.Data, docsActionPrefix), ":")
+	id, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil || query.Message == nil {
+		b.answerCallback(query.ID, "")
+		return
+	}
+
+	message := query.Message
+	chatID, userID := message.Chat.ID, query.From.ID
+
+	// lists sent to groups before /docs became private would show the library again
+	if isGroup(message.Chat) {
+		b.answerCallback(query.ID, "Use /docs in a private chat with me.")
+		return
+	}
+
+	ctx, ok := b.identify(ctx, query.From, chatID)
+	if !ok {
+		b.answerCallback(query.ID, "")
+		return
+	}
+
+	doc, err := b.docRepo.GetByID(ctx, id)
+	if err != nil {
+		slog.Error("failed to get document", "chat_id", chatID, "document_id", id, "error", err)
+		b.answerCallback(query.ID, "Sorry, something went wrong. Please try again later.")
+		return
+	}
+	if doc == nil {
+		b.answerCallback(query.ID, "This document has been deleted.")
+		return
+	}
+	if doc.UserID == nil || *doc.UserID != userID {
+		b.answerCallback(query.ID, "Only the owner of this document can do that.")
+		return
+	}
+
+	slog.Info("document action", "chat_id", chatID, "user_id", userID, "document_id", id, "action", action)
+
+	switch action {
+	case docsUse:
+		b.setActiveDocument(ctx, chatID, activeFrom(doc))
+		b.answerCallback(query.ID, "Now answering from "+doc.Filename)
+		b.refreshLibrary(ctx, chatID, message.MessageID, userID)
+		b.sendText(chatID, fmt.Sprintf("📄 %s is the active document now, ask me anything about it.", doc.Filename))
+
+	case docsGuide:
+		ctx, meter := ai.WithMeter(ctx)
+		defer b.recordUsage(ctx, userID, meter)
+
+		if refusal := b.aiRefusal(ctx, chatID, userID); refusal != "" {
+			b.answerCallback(query.ID, refusal)
+			return
+		}
+
+		content, err := b.docRepo.Content(ctx, id)
+		if err != nil {
+			slog.Error("failed to get document content", "document_id", id, "error", err)
+			b.answerCallback(query.ID, "Sorry, something went wrong. Please try again later.")
+			return
+		}
+		if content == "" {
+			b.answerCallback(query.ID, "The text of this document wasn't kept, please send the file again.")
+			return
+		}
+
+		b.answerCallback(query.ID, "🎓 Creating Educational Guide...")
+		sent, err := b.sendPlaceholder(chatID, 0, "🎓 Creating Educational Guide...")
+		if err != nil {
+			slog.Error("failed to send placeholder", "chat_id", chatID, "error", err)
+			return
+		}
+		defer b.releasePlaceholder(chatID, sent.MessageID)
+
+		// a guide is usually followed by questions about the same document
+		b.setActiveDocument(ctx, chatID, activeFrom(doc))
+		b.createEducationalGuide(ctx, chatID, sent.MessageID, content, doc.Filename, doc.FileType)
+
+	case docsDelete:
+		deleted, err := b.docRepo.Delete(ctx, id, userID)
+		if err != nil {
+			slog.Error("failed to delete document", "document_id", id, "error", err)
+			b.answerCallback(query.ID, "Sorry, couldn't delete the document right now.")
+			return
+		}
+		// the database clears it in every chat along with the document
+		b.activeDocs.DeleteFunc(func(_ int64, active activeDocument) bool { return active.ID == id })
+
+		if deleted {
+			b.answerCallback(query.ID, "Deleted "+doc.Filename)
+		} else {
+			b.answerCallback(query.ID, "This document has been deleted.")
+		}
+		b.refreshLibrary(ctx, chatID, message.MessageID, userID)
+
+	default:
+		b.answerCallback(query.ID, "")
+	}
+}
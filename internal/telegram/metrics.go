@@ -0,0 +1,49 @@
+package telegram
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nurashi/Newton/internal/metrics"
+)
+
+// countUpdate records an incoming update by type and, for commands, command name
+func (b *Bot) countUpdate(update tgbotapi.Update) {
+	metrics.UpdatesTotal.WithLabelValues(b.updateKind(update)).Inc()
+}
+
+// updateKind returns the type of update and, for registered commands, the command name.
+// Unknown commands are "other" so users cannot create unbounded label values.
+func (b *Bot) updateKind(update tgbotapi.Update) (kind, command string) {
+	kind = "other"
+
+	switch {
+	case update.Message != nil:
+		msg := update.Message
+		switch {
+		case msg.IsCommand():
+			kind, command = "command", "other"
+			if cmd, ok := b.router.lookup(msg.Command()); ok {
+				command = cmd.Name
+			}
+		case msg.Text != "":
+			kind = "text"
+		case msg.Document != nil:
+			kind = "document"
+		case msg.Photo != nil:
+			kind = "photo"
+		case msg.Voice != nil || msg.Audio != nil:
+			kind = "voice"
+		default:
+			kind = "message"
+		}
+	case update.EditedMessage != nil:
+		kind = "edited_message"
+	case update.CallbackQuery != nil:
+		kind = "callback_query"
+	case update.InlineQuery != nil:
+		kind = "inline_query"
+	case update.ChosenInlineResult != nil:
+		kind = "chosen_inline_result"
+	}
+
+	return kind, command
+}
@@ -0,0 +1,126 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"slices"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nurashi/Newton/internal/metrics"
+	"github.com/nurashi/Newton/internal/models"
+)
+
+type userKey struct{}
+
+// withUser stores the sender's stored profile for the rest of the update
+func withUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// userFrom returns the sender's profile, nil when it could not be saved
+func userFrom(ctx context.Context) *models.User {
+	user, _ := ctx.Value(userKey{}).(*models.User)
+	return user
+}
+
+// isAdmin reports whether userID is a configured admin or has the admin role
+func (b *Bot) isAdmin(ctx context.Context, userID int64) bool {
+	if slices.Contains(b.cfg.AdminIDs, userID) {
+		return true
+	}
+
+	user := userFrom(ctx)
+	return user != nil && user.ID == userID && user.Role == models.RoleAdmin
+}
+
+// isAdminUser reports whether a loaded user is an admin, by configuration or by their stored role
+func (b *Bot) isAdminUser(user *models.User) bool {
+	return user.Role == models.RoleAdmin || slices.Contains(b.cfg.AdminIDs, user.ID)
+}
+
+// roleOf is the role commands are offered for, configured admins count as admins
+func (b *Bot) roleOf(ctx context.Context, userID int64) string {
+	if b.isAdmin(ctx, userID) {
+		return models.RoleAdmin
+	}
+	return models.RoleUser
+}
+
+// recoverPanic reports a panicking command with its name and answers with the error id
+func (b *Bot) recoverPanic(cmd *command, next commandFunc) commandFunc {
+	return func(ctx context.Context, message *tgbotapi.Message, args string) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+
+			chatID, userID, name := message.Chat.ID, message.From.ID, cmd.Name
+			id := b.reportPanic(ctx, models.ErrorEvent{
+				ChatID:     &chatID,
+				UserID:     &userID,
+				UpdateType: "command",
+				Command:    &name,
+				Message:    fmt.Sprint(r),
+				Stack:      string(debug.Stack()),
+			})
+			b.sendText(chatID, errorReply(id))
+		}()
+
+		next(ctx, message, args)
+	}
+}
+
+// measure records how long a command took
+func (b *Bot) measure(cmd *command, next commandFunc) commandFunc {
+	return func(ctx context.Context, message *tgbotapi.Message, args string) {
+		start := time.Now()
+		defer func() {
+			metrics.Since(metrics.CommandDuration.WithLabelValues(cmd.Name), start)
+			slog.Debug("command handled", "chat_id", message.Chat.ID, "user_id", message.From.ID, "command", cmd.Name, "latency_ms", time.Since(start).Milliseconds())
+		}()
+
+		next(ctx, message, args)
+	}
+}
+
+// authorize hides commands that need a role the sender doesn't have
+func (b *Bot) authorize(cmd *command, next commandFunc) commandFunc {
+	if cmd.Role == "" {
+		return next
+	}
+
+	return func(ctx context.Context, message *tgbotapi.Message, args string) {
+		if b.roleOf(ctx, message.From.ID) != cmd.Role {
+			slog.Warn("command refused", "chat_id", message.Chat.ID, "user_id", message.From.ID, "command", cmd.Name)
+			b.sendMessage(message.Chat.ID, "Unknown command. Use /help to see available commands.")
+			return
+		}
+
+		next(ctx, message, args)
+	}
+}
+
+// rateLimited applies the AI rate limits and token quota
+func (b *Bot) rateLimited(cmd *command, next commandFunc) commandFunc {
+	return func(ctx context.Context, message *tgbotapi.Message, args string) {
+		if !b.allowAI(ctx, message.Chat.ID, message.From.ID) {
+			return
+		}
+
+		next(ctx, message, args)
+	}
+}
+
+// chatAction shows action, e.g. "typing", while the command runs
+func (b *Bot) chatAction(action string) middleware {
+	return func(cmd *command, next commandFunc) commandFunc {
+		return func(ctx context.Context, message *tgbotapi.Message, args string) {
+			b.api.Send(tgbotapi.NewChatAction(message.Chat.ID, action))
+			next(ctx, message, args)
+		}
+	}
+}
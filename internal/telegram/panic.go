@@ -0,0 +1,104 @@
+package telegram
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nurashi/Newton/internal/metrics"
+	"github.com/nurashi/Newton/internal/models"
+)
+
+// recoverUpdate is deferred around every update, a panic is reported instead of killing the bot
+func (b *Bot) recoverUpdate(ctx context.Context, update tgbotapi.Update) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	kind, command := b.updateKind(update)
+	event := models.ErrorEvent{
+		UpdateType: kind,
+		Message:    fmt.Sprint(r),
+		Stack:      string(debug.Stack()),
+	}
+	if command != "" {
+		event.Command = &command
+	}
+
+	var chatID int64
+	if chat := updateChat(update); chat != nil {
+		chatID = chat.ID
+		event.ChatID = &chatID
+	}
+	if user := update.SentFrom(); user != nil {
+		event.UserID = &user.ID
+	}
+
+	id := b.reportPanic(ctx, event)
+	if chatID != 0 {
+		b.sendText(chatID, errorReply(id))
+	}
+}
+
+// reportPanic logs and stores a recovered panic and tells the error chat about it, returning the error id
+func (b *Bot) reportPanic(ctx context.Context, event models.ErrorEvent) string {
+	event.ID = newErrorID()
+	metrics.HandlerPanicsTotal.Inc()
+
+	slog.Error("handler panicked",
+		"error_id", event.ID,
+		"chat_id", deref(event.ChatID),
+		"user_id", deref(event.UserID),
+		"update_type", event.UpdateType,
+		"command", deref(event.Command),
+		"panic", event.Message,
+		"stack", event.Stack)
+
+	// the update's context may be cancelled already, the event is still worth keeping
+	if err := b.errorRepo.Create(context.WithoutCancel(ctx), event); err != nil {
+		slog.Error("failed to store error event", "error_id", event.ID, "error", err)
+	}
+
+	if b.cfg.ErrorChatID != 0 {
+		where := event.UpdateType
+		if event.Command != nil {
+			where = "/" + *event.Command
+		}
+		b.sendText(b.cfg.ErrorChatID, fmt.Sprintf("⚠️ Panic %s in %s: %s", event.ID, where, truncate(event.Message, 500)))
+	}
+
+	return event.ID
+}
+
+// errorReply is what the user sees when their update crashed a handler
+func errorReply(id string) string {
+	return fmt.Sprintf("Sorry, something went wrong on our side. If it keeps happening, please report error ID %s.", id)
+}
+
+// newErrorID is a short random id users can quote
+func newErrorID() string {
+	buf := make([]byte, 4)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// deref logs a missing optional field as null rather than a pointer
+func deref[T any](p *T) any {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "…"
+}
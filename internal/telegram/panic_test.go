@@ -0,0 +1,41 @@
+package telegram
+
+import (
+	"context"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/nurashi/Newton/internal/repository"
+)
+
+func TestRecoverUpdateInlineCallback(t *testing.T) {
+	// nothing listens on the port, storing the event fails and is only logged
+	pool, err := pgxpool.New(context.Background(), "postgres://newton@127.0.0.1:1/newton?connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	b := &Bot{errorRepo: repository.NewErrorRepository(pool)}
+
+	// a button under an inline mode message, the callback has no Message
+	update := tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:              "1",
+		From:            &tgbotapi.User{ID: 42},
+		InlineMessageID: "inline",
+		Data:            "regen:1",
+	}}
+
+	recovered := false
+	func() {
+		defer func() { recovered = true }()
+		defer b.recoverUpdate(context.Background(), update)
+		panic("handler failed")
+	}()
+
+	if !recovered {
+		t.Fatal("recoverUpdate did not return")
+	}
+}
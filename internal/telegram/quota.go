@@ -0,0 +1,137 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nurashi/Newton/internal/ai"
+	"github.com/nurashi/Newton/internal/models"
+	"github.com/nurashi/Newton/internal/ratelimit"
+)
+
+// allowAI checks the rate limits and the user's token quota before an AI request and
+// tells the user when it is refused
+func (b *Bot) allowAI(ctx context.Context, chatID, userID int64) bool {
+	if refusal := b.aiRefusal(ctx, chatID, userID); refusal != "" {
+		b.sendMessage(chatID, refusal)
+		return false
+	}
+	return true
+}
+
+// aiRefusal explains why an AI request is refused, empty when it's allowed
+func (b *Bot) aiRefusal(ctx context.Context, chatID, userID int64) string {
+	if ok, wait := b.userLimiter.Allow(userID); !ok {
+		return fmt.Sprintf("⏳ Slow down a little, you can send another request in %s.", formatWait(wait))
+	}
+	if ok, wait := b.chatLimiter.Allow(chatID); !ok {
+		return fmt.Sprintf("⏳ This chat is sending too many requests, try again in %s.", formatWait(wait))
+	}
+
+	dailyLimit := b.userDailyLimit(ctx)
+	if dailyLimit <= 0 && b.limits.MonthlyTokens <= 0 {
+		return ""
+	}
+
+	now := time.Now()
+	totals, err := b.usageRepo.Totals(ctx, userID, now)
+	if err != nil {
+		// an outage of the usage table should not take the bot down with it
+		slog.Error("failed to check quota", "user_id", userID, "error", err)
+		return ""
+	}
+
+	nextDay, nextMonth := quotaResets(now)
+	switch {
+	case b.limits.MonthlyTokens > 0 && totals.Month >= b.limits.MonthlyTokens:
+		return fmt.Sprintf("🚫 You've used your monthly AI limit of %d tokens. It resets in %s.", b.limits.MonthlyTokens, formatWait(nextMonth.Sub(now)))
+	case dailyLimit > 0 && totals.Day >= dailyLimit:
+		return fmt.Sprintf("🚫 You've used your daily AI limit of %d tokens. It resets in %s.", dailyLimit, formatWait(nextDay.Sub(now)))
+	}
+
+	return ""
+}
+
+// recordUsage stores the tokens the AI requests of one update cost
+func (b *Bot) recordUsage(ctx context.Context, userID int64, meter *ai.Meter) {
+	usage := meter.Usage()
+	if usage.TotalTokens == 0 {
+		return
+	}
+
+	// the spend must be recorded even when the request was cancelled by shutdown
+	err := b.usageRepo.Add(context.WithoutCancel(ctx), userID, time.Now(), usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens)
+	if err != nil {
+		slog.Error("failed to record usage", "user_id", userID, "tokens", usage.TotalTokens, "error", err)
+	}
+}
+
+func (b *Bot) handleQuotaCommand(ctx context.Context, chatID, userID int64) {
+	now := time.Now()
+	totals, err := b.usageRepo.Totals(ctx, userID, now)
+	if err != nil {
+		slog.Error("failed to get usage", "chat_id", chatID, "user_id", userID, "error", err)
+		b.sendMessage(chatID, "Sorry, couldn't retrieve your quota right now.")
+		return
+	}
+
+	b.sendPlainMessage(chatID, quotaText(totals, b.userDailyLimit(ctx), b.limits.MonthlyTokens, b.userLimiter, now))
+}
+
+// quotaText renders the /quota reply
+func quotaText(totals models.UsageTotals, dailyLimit, monthlyLimit int64, limiter *ratelimit.Limiter, now time.Time) string {
+	nextDay, nextMonth := quotaResets(now)
+
+	return fmt.Sprintf(`Your AI quota
+
+Today: %s
+This month: %s
+Requests: %s`,
+		budgetLine(totals.Day, dailyLimit, nextDay.Sub(now)),
+		budgetLine(totals.Month, monthlyLimit, nextMonth.Sub(now)),
+		rateLine(limiter))
+}
+
+// rateLine describes the per-minute request limit, a nil limiter allows everything
+func rateLine(limiter *ratelimit.Limiter) string {
+	if perMinute := limiter.PerMinute(); perMinute > 0 {
+		return fmt.Sprintf("up to %d per minute", perMinute)
+	}
+	return "no per-minute limit"
+}
+
+// budgetLine describes the usage of one quota period
+func budgetLine(used, limit int64, resetsIn time.Duration) string {
+	if limit <= 0 {
+		return fmt.Sprintf("%d tokens used, no limit", used)
+	}
+
+	remaining := max(limit-used, 0)
+	return fmt.Sprintf("%d of %d tokens left (resets in %s)", remaining, limit, formatWait(resetsIn))
+}
+
+// quotaResets returns when the current UTC day and month end
+func quotaResets(now time.Time) (time.Time, time.Time) {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	return day, month
+}
+
+// formatWait renders a duration the way people say it, e.g. "5h 12m" or "40s"
+func formatWait(d time.Duration) string {
+	d = d.Round(time.Second)
+
+	switch {
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%dd %dh", d/(24*time.Hour), (d%(24*time.Hour))/time.Hour)
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh %dm", d/time.Hour, (d%time.Hour)/time.Minute)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm %ds", d/time.Minute, (d%time.Minute)/time.Second)
+	default:
+		return fmt.Sprintf("%ds", max(d/time.Second, 1))
+	}
+}
@@ -0,0 +1,56 @@
+package telegram
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nurashi/Newton/internal/models"
+	"github.com/nurashi/Newton/internal/ratelimit"
+)
+
+func TestQuotaText(t *testing.T) {
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	totals := models.UsageTotals{Day: 1500, Month: 40000}
+
+	tests := []struct {
+		name         string
+		dailyLimit   int64
+		monthlyLimit int64
+		limiter      *ratelimit.Limiter
+		want         []string
+	}{
+		{
+			name:         "limited",
+			dailyLimit:   10000,
+			monthlyLimit: 30000,
+			limiter:      ratelimit.New(20, 5),
+			want: []string{
+				"Today: 8500 of 10000 tokens left (resets in 12h 0m)",
+				"This month: 0 of 30000 tokens left (resets in 16d 12h)",
+				"Requests: up to 20 per minute",
+			},
+		},
+		{
+			name: "unlimited",
+			// rate limiting is disabled, ratelimit.New returns nil
+			limiter: ratelimit.New(0, 0),
+			want: []string{
+				"Today: 1500 tokens used, no limit",
+				"This month: 40000 tokens used, no limit",
+				"Requests: no per-minute limit",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := quotaText(totals, tt.dailyLimit, tt.monthlyLimit, tt.limiter, now)
+			for _, line := range tt.want {
+				if !strings.Contains(got, line) {
+					t.Errorf("quotaText() = %q, missing %q", got, line)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nurashi/Newton/internal/models"
+)
+
+// commandFunc runs a command with its parsed arguments
+type commandFunc func(ctx context.Context, message *tgbotapi.Message, args string)
+
+// middleware wraps the handler of cmd, e.g. to check access or measure it
+type middleware func(cmd *command, next commandFunc) commandFunc
+
+// argParser validates and normalizes command arguments, an error is answered with the command's usage
+type argParser func(args string) (string, error)
+
+// command is one entry of the command registry, /help and the Telegram menu are generated from it
+type command struct {
+	Name        string
+	Description string
+	// Usage is the syntax shown in /help and when the arguments are rejected, e.g. "/weather <city>"
+	Usage string
+	// Args is nil when any arguments are accepted
+	Args argParser
+	// Role is needed to see and run the command, empty for everyone
+	Role string
+	// Required commands can't be disabled with /settings
+	Required bool
+	// Middleware runs inside the router's chain, right before Handler
+	Middleware []middleware
+	Handler    commandFunc
+}
+
+// router looks up commands and runs them through the middleware chain
+type router struct {
+	commands []*command
+	byName   map[string]*command
+	// chain wraps every command, outermost first
+	chain []middleware
+	// reply answers invalid arguments
+	reply func(chatID int64, text string)
+}
+
+func newRouter(reply func(chatID int64, text string), chain ...middleware) *router {
+	return &router{byName: make(map[string]*command), chain: chain, reply: reply}
+}
+
+// register adds commands in the order they are listed in /help
+func (r *router) register(cmds ...*command) {
+	for _, cmd := range cmds {
+		if _, dup := r.byName[cmd.Name]; dup {
+			panic(fmt.Sprintf("command /%s registered twice", cmd.Name))
+		}
+		r.commands = append(r.commands, cmd)
+		r.byName[cmd.Name] = cmd
+	}
+}
+
+func (r *router) lookup(name string) (*command, bool) {
+	cmd, ok := r.byName[strings.ToLower(name)]
+	return cmd, ok
+}
+
+// dispatch runs the command of message, false when there is no such command
+func (r *router) dispatch(ctx context.Context, message *tgbotapi.Message) bool {
+	cmd, ok := r.lookup(message.Command())
+	if !ok {
+		return false
+	}
+
+	handler := cmd.Handler
+	for i := len(cmd.Middleware) - 1; i >= 0; i-- {
+		handler = cmd.Middleware[i](cmd, handler)
+	}
+	handler = r.parseArgs(cmd, handler)
+	for i := len(r.chain) - 1; i >= 0; i-- {
+		handler = r.chain[i](cmd, handler)
+	}
+
+	handler(ctx, message, message.CommandArguments())
+	return true
+}
+
+// visible returns the commands a user with role can use
+func (r *router) visible(role string) []*command {
+	var cmds []*command
+	for _, cmd := range r.commands {
+		if cmd.Role == "" || cmd.Role == role {
+			cmds = append(cmds, cmd)
+		}
+	}
+	return cmds
+}
+
+// help renders the command list for a user with role, without the disabled commands
+func (r *router) help(role string, disabled []string) string {
+	var sb strings.Builder
+	sb.WriteString("Commands:\n")
+	for _, cmd := range r.visible(role) {
+		if slices.Contains(disabled, cmd.Name) {
+			continue
+		}
+		usage := cmd.Usage
+		if usage == "" {
+			usage = "/" + cmd.Name
+		}
+		fmt.Fprintf(&sb, "%s - %s\n", usage, cmd.Description)
+	}
+	sb.WriteString("\nJust send me any message and I'll respond using AI!")
+	return sb.String()
+}
+
+// botCommands is the Telegram menu for a user with role
+func (r *router) botCommands(role string) []tgbotapi.BotCommand {
+	var menu []tgbotapi.BotCommand
+	for _, cmd := range r.visible(role) {
+		menu = append(menu, tgbotapi.BotCommand{Command: cmd.Name, Description: cmd.Description})
+	}
+	return menu
+}
+
+// publishCommands sets the Telegram command menu, configured admins and users with the admin role
+// get their commands too
+func (b *Bot) publishCommands(ctx context.Context) {
+	if _, err := b.api.Request(tgbotapi.NewSetMyCommands(b.router.botCommands("")...)); err != nil {
+		slog.Error("failed to set bot commands", "error", err)
+	}
+
+	admins := slices.Clone(b.cfg.AdminIDs)
+	if ids, err := b.userRepo.IDsWithRole(ctx, models.RoleAdmin); err != nil {
+		slog.Error("failed to list admins", "error", err)
+	} else {
+		admins = append(admins, ids...)
+	}
+
+	slices.Sort(admins)
+	for _, id := range slices.Compact(admins) {
+		b.publishUserCommands(id, models.RoleAdmin)
+	}
+}
+
+// publishUserCommands sets the command menu of a user's private chat for role, users fall back
+// to the default menu
+func (b *Bot) publishUserCommands(userID int64, role string) {
+	scope := tgbotapi.NewBotCommandScopeChat(userID)
+
+	var req tgbotapi.Chattable = tgbotapi.NewDeleteMyCommandsWithScope(scope)
+	if role != models.RoleUser {
+		req = tgbotapi.NewSetMyCommandsWithScope(scope, b.router.botCommands(role)...)
+	}
+	if _, err := b.api.Request(req); err != nil {
+		slog.Error("failed to set user commands", "user_id", userID, "role", role, "error", err)
+	}
+}
+
+// parseArgs answers invalid arguments with the command's usage instead of running it
+func (r *router) parseArgs(cmd *command, next commandFunc) commandFunc {
+	if cmd.Args == nil {
+		return next
+	}
+
+	return func(ctx context.Context, message *tgbotapi.Message, args string) {
+		parsed, err := cmd.Args(args)
+		if err != nil {
+			text := err.Error()
+			if cmd.Usage != "" {
+				text += "\nUsage: " + cmd.Usage
+			}
+			r.reply(message.Chat.ID, text)
+			return
+		}
+		next(ctx, message, parsed)
+	}
+}
+
+// requiredText accepts any non-empty argument, msg explains what is missing
+func requiredText(msg string) argParser {
+	return func(args string) (string, error) {
+		args = strings.TrimSpace(args)
+		if args == "" {
+			return "", fmt.Errorf("%s", msg)
+		}
+		return args, nil
+	}
+}
+
+// oneOf accepts an empty argument or one of options, case-insensitively
+func oneOf(options ...string) argParser {
+	return func(args string) (string, error) {
+		args = strings.ToLower(strings.TrimSpace(args))
+		if args == "" || slices.Contains(options, args) {
+			return args, nil
+		}
+		return "", fmt.Errorf("Unknown option %q.", args)
+	}
+}
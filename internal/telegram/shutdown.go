@@ -0,0 +1,157 @@
+package telegram
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	restartNotice = "⚠️ The bot is restarting, please resend your message in a minute."
+	// cancelGrace is how long handlers get to return after their context is cancelled
+	cancelGrace = 5 * time.Second
+)
+
+// placeholderKey identifies a "Thinking..." style message that is still waiting for its answer
+type placeholderKey struct {
+	chatID    int64
+	messageID int
+}
+
+// placeholders tracks pending status messages so shutdown can resolve the ones left behind
+type placeholders struct {
+	mu      sync.Mutex
+	pending map[placeholderKey]struct{}
+}
+
+func newPlaceholders() *placeholders {
+	return &placeholders{pending: make(map[placeholderKey]struct{})}
+}
+
+func (p *placeholders) add(chatID int64, messageID int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending[placeholderKey{chatID, messageID}] = struct{}{}
+}
+
+func (p *placeholders) remove(chatID int64, messageID int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.pending, placeholderKey{chatID, messageID})
+}
+
+// drain empties the tracker and returns what was still pending
+func (p *placeholders) drain() []placeholderKey {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	keys := make([]placeholderKey, 0, len(p.pending))
+	for k := range p.pending {
+		keys = append(keys, k)
+	}
+	p.pending = make(map[placeholderKey]struct{})
+	return keys
+}
+
+// sendPlaceholder sends a status message that is tracked until releasePlaceholder is called,
+// replyTo is the message it answers or 0
+func (b *Bot) sendPlaceholder(chatID int64, replyTo int, text string) (tgbotapi.Message, error) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyToMessageID = replyTo
+	sent, err := b.api.Send(msg)
+	if err != nil {
+		return sent, err
+	}
+
+	b.placeholders.add(chatID, sent.MessageID)
+	return sent, nil
+}
+
+func (b *Bot) releasePlaceholder(chatID int64, messageID int) {
+	b.placeholders.remove(chatID, messageID)
+}
+
+// failureText is the reply for a failed request, a restart notice when it failed because of shutdown
+func failureText(ctx context.Context, text string) string {
+	if ctx.Err() != nil {
+		return restartNotice
+	}
+	return text
+}
+
+// shutdown stops taking updates, lets in-flight handlers finish within the configured
+// timeout, cancels the ones that don't and resolves any placeholder left behind
+func (b *Bot) shutdown(d *dispatcher, cancelWork context.CancelFunc) error {
+	slog.Info("shutting down, stopping update intake")
+
+	switch b.cfg.Mode {
+	case "webhook":
+		if b.webhookQueue != nil {
+			b.webhookQueue.stop()
+		}
+		if b.webhookServer != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), cancelGrace)
+			if err := b.webhookServer.Shutdown(ctx); err != nil {
+				slog.Error("failed to stop webhook server", "error", err)
+			}
+			cancel()
+		}
+	default:
+		b.api.StopReceivingUpdates()
+	}
+
+	d.Close()
+
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), b.cfg.ShutdownTimeout)
+	defer cancelDrain()
+
+	if !d.Wait(drainCtx) {
+		slog.Warn("shutdown timeout reached, cancelling in-flight requests", "timeout", b.cfg.ShutdownTimeout.String())
+		cancelWork()
+
+		graceCtx, cancelGraceCtx := context.WithTimeout(context.Background(), cancelGrace)
+		defer cancelGraceCtx()
+		if !d.Wait(graceCtx) {
+			slog.Warn("some handlers did not stop in time")
+		}
+	}
+	cancelWork()
+
+	// stopped after the handlers, which may still start a broadcast or debounce an inline query;
+	// broadcasts save their progress and resume on the next start, pending inline queries are
+	// dropped since Telegram expires them anyway
+	b.broadcasts.stop()
+	b.inline.stop()
+
+	// a worker stuck in a handler leaves its queue behind, those chats are told to resend
+	if skipped := d.drain(); skipped > 0 {
+		slog.Warn("skipped queued updates", "count", skipped)
+	}
+
+	orphaned := b.placeholders.drain()
+	for _, p := range orphaned {
+		edit := tgbotapi.NewEditMessageText(p.chatID, p.messageID, restartNotice)
+		if _, err := b.api.Send(edit); err != nil {
+			slog.Error("failed to resolve placeholder", "chat_id", p.chatID, "error", err)
+		}
+	}
+
+	slog.Info("shutdown complete", "placeholders_resolved", len(orphaned))
+	return nil
+}
+
+// notifySkipped tells a chat its update was dropped because the bot is going down
+func (b *Bot) notifySkipped(update tgbotapi.Update) {
+	switch {
+	case update.CallbackQuery != nil:
+		b.answerCallback(update.CallbackQuery.ID, restartNotice)
+	case update.Message != nil:
+		if isGroup(update.Message.Chat) && !b.addressed(update.Message) {
+			return
+		}
+		b.sendPlainMessage(update.Message.Chat.ID, restartNotice)
+	}
+}
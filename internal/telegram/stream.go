@@ -0,0 +1,131 @@
+package telegram
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// streamEditInterval keeps progressive edits well below Telegram's per-chat flood limits
+const streamEditInterval = 1500 * time.Millisecond
+
+// streamWriter renders a streamed AI answer by editing the placeholder message as text arrives.
+// When the current message reaches maxTelegramLength it is finalized and a new one is started.
+type streamWriter struct {
+	bot       *Bot
+	chatID    int64
+	messageID int
+
+	part     strings.Builder // text of the message currently being edited
+	rendered string          // last text pushed to Telegram for the current message
+	lastEdit time.Time
+	received bool
+}
+
+func (b *Bot) newStreamWriter(chatID int64, placeholderID int) *streamWriter {
+	return &streamWriter{
+		bot:       b,
+		chatID:    chatID,
+		messageID: placeholderID,
+	}
+}
+
+// Write is the onDelta callback handed to the provider
+func (w *streamWriter) Write(delta string) {
+	w.received = true
+	w.part.WriteString(delta)
+
+	for w.part.Len() > maxTelegramLength {
+		w.rollover()
+	}
+
+	if time.Since(w.lastEdit) >= streamEditInterval {
+		w.edit(w.part.String())
+	}
+}
+
+// rollover finalizes the current message at a line break and moves the rest into a new message
+func (w *streamWriter) rollover() {
+	text := w.part.String()
+
+	// leave room for the closing fences sanitizeMarkdown may add
+	limit := maxTelegramLength - 16
+	cut := strings.LastIndex(text[:limit], "\n")
+	if cut <= 0 {
+		cut = limit
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+	}
+
+	head, tail := text[:cut], strings.TrimPrefix(text[cut:], "\n")
+
+	// keep a code block that spans the cut open in the next message
+	if strings.Count(head, "```")%2 != 0 {
+		tail = "```\n" + tail
+	}
+
+	if _, err := w.bot.sendLongMessage(w.chatID, w.messageID, head, true); err != nil {
+		slog.Error("failed to finalize streamed message part", "chat_id", w.chatID, "error", err)
+	}
+
+	w.part.Reset()
+	w.part.WriteString(tail)
+	w.rendered = ""
+
+	// the finalized message must never be edited again, without a new one the next edit retries
+	w.bot.releasePlaceholder(w.chatID, w.messageID)
+	w.messageID = 0
+	w.start()
+}
+
+// start sends the message the next part is streamed into, false when Telegram refused it
+func (w *streamWriter) start() bool {
+	sent, err := w.bot.sendPlaceholder(w.chatID, 0, "...")
+	if err != nil {
+		slog.Error("failed to start next streamed message", "chat_id", w.chatID, "error", err)
+		return false
+	}
+	w.messageID = sent.MessageID
+	return true
+}
+
+// edit pushes plain text to Telegram, markdown is applied only once the message is complete
+func (w *streamWriter) edit(text string) {
+	if strings.TrimSpace(text) == "" || text == w.rendered {
+		return
+	}
+
+	w.lastEdit = time.Now()
+
+	if w.messageID == 0 && !w.start() {
+		return
+	}
+
+	edit := tgbotapi.NewEditMessageText(w.chatID, w.messageID, text)
+	if _, err := w.bot.api.Send(edit); err != nil {
+		slog.Debug("failed to edit streamed message", "chat_id", w.chatID, "error", err)
+		return
+	}
+	w.rendered = text
+}
+
+// Release stops tracking the message currently being written as a pending placeholder
+func (w *streamWriter) Release() {
+	if w.messageID != 0 {
+		w.bot.releasePlaceholder(w.chatID, w.messageID)
+	}
+}
+
+// Finish renders the current message with markdown, suffix is appended to whatever was streamed.
+// Without a current message, e.g. after a failed rollover, the rest is sent as new messages.
+// It returns the id of the message the answer ends in.
+func (w *streamWriter) Finish(suffix string) (int, error) {
+	if w.messageID == 0 && !w.start() {
+		return w.bot.sendLongMessage(w.chatID, 0, w.part.String()+suffix, false)
+	}
+	return w.bot.sendLongMessage(w.chatID, w.messageID, w.part.String()+suffix, true)
+}
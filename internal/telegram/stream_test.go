@@ -0,0 +1,109 @@
+package telegram
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fakeTelegram answers the Bot API methods used to send and edit messages and records the calls
+type fakeTelegram struct {
+	mu        sync.Mutex
+	calls     []string
+	nextID    int
+	failEdits bool
+}
+
+func (f *fakeTelegram) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	method := path.Base(r.URL.Path)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, method)
+
+	switch method {
+	case "getMe":
+		fmt.Fprint(w, `{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"Newton","username":"newton_bot"}}`)
+	case "sendMessage":
+		f.nextID++
+		fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%d,"date":0,"chat":{"id":%s}}}`, f.nextID, r.Form.Get("chat_id"))
+	case "editMessageText":
+		if f.failEdits {
+			fmt.Fprint(w, `{"ok":false,"error_code":400,"description":"Bad Request: message to edit not found"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%s,"date":0,"chat":{"id":%s}}}`, r.Form.Get("message_id"), r.Form.Get("chat_id"))
+	default:
+		fmt.Fprint(w, `{"ok":true,"result":true}`)
+	}
+}
+
+func (f *fakeTelegram) count(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := 0
+	for _, c := range f.calls {
+		if c == method {
+			n++
+		}
+	}
+	return n
+}
+
+func newFakeBot(t *testing.T, fake *fakeTelegram) *Bot {
+	t.Helper()
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	api, err := tgbotapi.NewBotAPIWithClient("token", server.URL+"/bot%s/%s", server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Bot{api: api}
+}
+
+func TestFinishReturnsLastMessage(t *testing.T) {
+	long := strings.Repeat("A line of a long answer.\n", maxTelegramLength/10)
+
+	tests := []struct {
+		name      string
+		text      string
+		failEdits bool
+		wantID    int
+		wantSent  int
+	}{
+		{"edited in place", "short answer", false, 100, 0},
+		// the placeholder is gone, e.g. deleted by the user, the answer arrives as a new message
+		{"edit falls back to a new message", "short answer", true, 1, 1},
+		// the placeholder is deleted and the parts are sent anew
+		{"split into parts", long, false, 3, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeTelegram{failEdits: tt.failEdits}
+			b := newFakeBot(t, fake)
+
+			w := b.newStreamWriter(42, 100)
+			id, err := w.Finish(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != tt.wantID {
+				t.Errorf("Finish() = %d, want message %d", id, tt.wantID)
+			}
+			if n := fake.count("sendMessage"); n != tt.wantSent {
+				t.Errorf("sent %d messages, want %d", n, tt.wantSent)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package telegram
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nurashi/Newton/internal/ai"
+)
+
+const (
+	// defaultImagePrompt is asked about photos sent without a caption
+	defaultImagePrompt = "Describe this image."
+	// maxHistoryImages is how many of the latest photos of a conversation are sent to the AI again
+	maxHistoryImages = 3
+	maxImageSize     = 10 << 20
+	imageCacheSize   = 32
+)
+
+// imageCache keeps recently downloaded photos so follow-up questions don't download them again
+type imageCache struct {
+	mu     sync.Mutex
+	images map[string]ai.Image
+	order  []string
+}
+
+func newImageCache() *imageCache {
+	return &imageCache{images: make(map[string]ai.Image)}
+}
+
+func (c *imageCache) get(fileID string) (ai.Image, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	img, ok := c.images[fileID]
+	return img, ok
+}
+
+func (c *imageCache) put(fileID string, img ai.Image) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.images[fileID]; ok {
+		return
+	}
+	if len(c.order) >= imageCacheSize {
+		delete(c.images, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.images[fileID] = img
+	c.order = append(c.order, fileID)
+}
+
+// handlePhoto answers a question about a photo, the caption is the question
+func (b *Bot) handlePhoto(ctx context.Context, message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	userID := message.From.ID
+	group := isGroup(message.Chat)
+
+	prompt := strings.TrimSpace(message.Caption)
+	if group {
+		prompt = b.stripMention(prompt)
+	}
+	if prompt == "" {
+		prompt = defaultImagePrompt
+	}
+
+	if !b.allowAI(ctx, chatID, userID) {
+		return
+	}
+
+	if err := b.userRepo.IncrementMessageCount(ctx, userID); err != nil {
+		slog.Error("failed to increment message count", "user_id", userID, "error", err)
+	}
+
+	// sizes are ordered from the smallest to the largest
+	photo := message.Photo[len(message.Photo)-1]
+	slog.Debug("photo received", "chat_id", chatID, "user_id", userID, "width", photo.Width, "height", photo.Height, "size", photo.FileSize)
+
+	b.answer(ctx, aiTurn{
+		chatID:      chatID,
+		userID:      userID,
+		group:       group,
+		replyTo:     replyTarget(message),
+		prompt:      prompt,
+		imageFileID: &photo.FileID,
+	})
+}
+
+// fetchImage downloads a photo from Telegram, recently used ones come from the cache
+func (b *Bot) fetchImage(ctx context.Context, fileID string) (ai.Image, error) {
+	if img, ok := b.images.get(fileID); ok {
+		return img, nil
+	}
+
+	data, err := b.downloadFile(ctx, fileID, maxImageSize)
+	if err != nil {
+		return ai.Image{}, err
+	}
+
+	img := ai.Image{MimeType: http.DetectContentType(data), Data: data}
+	b.images.put(fileID, img)
+	return img, nil
+}
+
+// attachImage adds the photo of a stored message to its history entry, a photo that can't be
+// downloaded is mentioned instead so the AI knows it is missing
+func (b *Bot) attachImage(ctx context.Context, msg *ai.Message, fileID string) {
+	img, err := b.fetchImage(ctx, fileID)
+	if err != nil {
+		slog.Error("failed to fetch image", "error", err)
+		msg.Content += "\n[the attached image is no longer available]"
+		return
+	}
+	msg.Images = []ai.Image{img}
+}
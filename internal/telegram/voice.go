@@ -0,0 +1,146 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nurashi/Newton/internal/ai"
+)
+
+const (
+	// maxAudioSize is the largest file the Bot API lets bots download
+	maxAudioSize = 20 << 20
+	// maxSpeechLength keeps spoken answers within what TTS servers accept in one request
+	maxSpeechLength = 4000
+)
+
+// markdownSymbols are dropped before an answer is spoken
+var markdownSymbols = strings.NewReplacer("*", "", "_", "", "`", "", "#", "")
+
+// handleVoice transcribes a voice note or audio file and answers the transcript like a text message
+func (b *Bot) handleVoice(ctx context.Context, message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	userID := message.From.ID
+
+	if b.transcriber == nil {
+		b.sendMessage(chatID, "Voice messages aren't supported on this bot, please type your question.")
+		return
+	}
+
+	audio := ai.Audio{MimeType: "audio/ogg", FileName: "voice.ogg"}
+	var fileID string
+	var duration int
+	if message.Voice != nil {
+		fileID, duration = message.Voice.FileID, message.Voice.Duration
+		if message.Voice.MimeType != "" {
+			audio.MimeType = message.Voice.MimeType
+		}
+	} else {
+		fileID, duration = message.Audio.FileID, message.Audio.Duration
+		if message.Audio.MimeType != "" {
+			audio.MimeType = message.Audio.MimeType
+		}
+		if message.Audio.FileName != "" {
+			audio.FileName = message.Audio.FileName
+		}
+	}
+
+	if !b.allowAI(ctx, chatID, userID) {
+		return
+	}
+
+	if err := b.userRepo.IncrementMessageCount(ctx, userID); err != nil {
+		slog.Error("failed to increment message count", "user_id", userID, "error", err)
+	}
+
+	slog.Debug("voice message received", "chat_id", chatID, "user_id", userID, "duration_s", duration)
+
+	b.api.Send(tgbotapi.NewChatAction(chatID, tgbotapi.ChatTyping))
+	sent, err := b.sendPlaceholder(chatID, replyTarget(message), "🎧 Listening...")
+	if err != nil {
+		slog.Error("failed to send placeholder", "chat_id", chatID, "error", err)
+		return
+	}
+	defer b.releasePlaceholder(chatID, sent.MessageID)
+
+	audio.Data, err = b.downloadFile(ctx, fileID, maxAudioSize)
+	if err != nil {
+		slog.Error("failed to download voice message", "chat_id", chatID, "error", err)
+		b.editOrSendMessage(chatID, sent.MessageID, failureText(ctx, "Sorry, I couldn't download your voice message."))
+		return
+	}
+
+	resp, err := b.transcriber.Transcribe(ctx, audio)
+	if err != nil {
+		slog.Error("transcription failed", "chat_id", chatID, "user_id", userID, "error", err)
+		b.editOrSendMessage(chatID, sent.MessageID, failureText(ctx, "Sorry, I couldn't understand your voice message. Please try again later."))
+		return
+	}
+
+	transcript := resp.Text
+	if isGroup(message.Chat) {
+		transcript = b.stripMention(transcript)
+	}
+	if transcript == "" {
+		b.editOrSendMessage(chatID, sent.MessageID, "I couldn't hear any words in that recording.")
+		return
+	}
+
+	b.api.Send(tgbotapi.NewEditMessageText(chatID, sent.MessageID, "🎤 "+transcript))
+
+	user := userFrom(ctx)
+	b.answer(ctx, aiTurn{
+		chatID:  chatID,
+		userID:  userID,
+		group:   isGroup(message.Chat),
+		replyTo: replyTarget(message),
+		prompt:  transcript,
+		speak:   b.speaker != nil && user != nil && user.VoiceReplies,
+	})
+}
+
+// speak sends an answer as a voice note, the text answer has been sent already
+func (b *Bot) speak(ctx context.Context, chatID int64, replyTo int, text string) {
+	b.api.Send(tgbotapi.NewChatAction(chatID, tgbotapi.ChatRecordVoice))
+
+	audio, err := b.speaker.Speak(ctx, truncate(markdownSymbols.Replace(text), maxSpeechLength))
+	if err != nil {
+		slog.Error("speech synthesis failed", "chat_id", chatID, "error", err)
+		return
+	}
+
+	voice := tgbotapi.NewVoice(chatID, tgbotapi.FileBytes{Name: audio.FileName, Bytes: audio.Data})
+	voice.ReplyToMessageID = replyTo
+	if _, err := b.api.Send(voice); err != nil {
+		slog.Error("failed to send voice reply", "chat_id", chatID, "error", err)
+	}
+}
+
+func (b *Bot) handleVoiceCommand(ctx context.Context, message *tgbotapi.Message, option string) {
+	chatID, userID := message.Chat.ID, message.From.ID
+
+	if b.speaker == nil {
+		b.sendMessage(chatID, "Voice replies aren't available on this bot.")
+		return
+	}
+
+	if option == "" {
+		state := "off"
+		if user := userFrom(ctx); user != nil && user.VoiceReplies {
+			state = "on"
+		}
+		b.sendText(chatID, fmt.Sprintf("Voice replies are %s. When they are on, I answer your voice messages with a voice note too.\nUse /voice on or /voice off to change it.", state))
+		return
+	}
+
+	if err := b.userRepo.SetVoiceReplies(ctx, userID, option == "on"); err != nil {
+		slog.Error("failed to update voice replies", "user_id", userID, "error", err)
+		b.sendMessage(chatID, "Sorry, couldn't change your voice setting right now.")
+		return
+	}
+
+	b.sendText(chatID, fmt.Sprintf("Voice replies are %s.", option))
+}
@@ -0,0 +1,157 @@
+package telegram
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// updates returns the update stream for the configured mode
+func (b *Bot) updates() (tgbotapi.UpdatesChannel, error) {
+	switch b.cfg.Mode {
+	case "webhook":
+		return b.listenWebhook()
+	default:
+		// getUpdates is refused while a webhook is registered, e.g. after switching modes
+		if _, err := b.api.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+			return nil, fmt.Errorf("failed to delete webhook: %w", err)
+		}
+
+		u := tgbotapi.NewUpdate(0)
+		u.Timeout = 30
+		return b.api.GetUpdatesChan(u), nil
+	}
+}
+
+// listenWebhook registers the webhook with Telegram and serves it, updates are delivered on the returned channel
+func (b *Bot) listenWebhook() (tgbotapi.UpdatesChannel, error) {
+	wh := b.cfg.Webhook
+	path := "/" + strings.TrimPrefix(wh.Path, "/")
+
+	listener, err := net.Listen("tcp", wh.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", wh.Listen, err)
+	}
+
+	params := tgbotapi.Params{}
+	params["url"] = strings.TrimSuffix(wh.URL, "/") + path
+	params["secret_token"] = wh.SecretToken
+	if _, err := b.api.MakeRequest("setWebhook", params); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set webhook: %w", err)
+	}
+
+	queue := &webhookQueue{ch: make(chan tgbotapi.Update, b.api.Buffer), stopped: make(chan struct{})}
+	b.webhookQueue = queue
+
+	mux := http.NewServeMux()
+	mux.Handle(path, b.webhookHandler(queue))
+
+	b.webhookServer = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		defer queue.close()
+
+		var err error
+		if wh.CertFile != "" {
+			err = b.webhookServer.ServeTLS(listener, wh.CertFile, wh.KeyFile)
+		} else {
+			err = b.webhookServer.Serve(listener)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("webhook server failed", "error", err)
+		}
+	}()
+
+	slog.Info("webhook listening", "listen", wh.Listen, "path", path)
+	return queue.ch, nil
+}
+
+// webhookQueue hands updates from HTTP handlers to Run. Serve returns before running
+// handlers finish, so closing is guarded to never race with a send.
+type webhookQueue struct {
+	mu       sync.RWMutex
+	closed   bool
+	ch       chan tgbotapi.Update
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+func (q *webhookQueue) push(ctx context.Context, update tgbotapi.Update) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return false
+	}
+
+	select {
+	case q.ch <- update:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-q.stopped:
+		return false
+	}
+}
+
+// stop makes pending and future pushes fail once Run no longer reads the channel
+func (q *webhookQueue) stop() {
+	q.stopOnce.Do(func() { close(q.stopped) })
+}
+
+func (q *webhookQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.closed {
+		q.closed = true
+		close(q.ch)
+	}
+}
+
+// webhookHandler verifies Telegram's secret token and forwards the decoded update
+func (b *Bot) webhookHandler(queue *webhookQueue) http.Handler {
+	secret := []byte(b.cfg.Webhook.SecretToken)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(secretTokenHeader)), secret) != 1 {
+			slog.Warn("rejected webhook request with bad secret", "remote_addr", r.RemoteAddr)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		var update tgbotapi.Update
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&update); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		if !queue.push(r.Context(), update) {
+			// Telegram redelivers updates that were not acknowledged
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS documents (
+    id BIGSERIAL PRIMARY KEY,
+    chat_id BIGINT NOT NULL,
+    user_id BIGINT,
+    filename VARCHAR(255) NOT NULL,
+    file_type VARCHAR(16) NOT NULL,
+    char_count INTEGER DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_documents_chat ON documents(chat_id);
+
+-- embeddings are kept as plain arrays and ranked by cosine similarity in Go,
+-- so the bot runs on a stock Postgres without the pgvector extension
+CREATE TABLE IF NOT EXISTS document_chunks (
+    id BIGSERIAL PRIMARY KEY,
+    document_id BIGINT NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    chunk_index INTEGER NOT NULL,
+    location VARCHAR(64),
+    content TEXT NOT NULL,
+    embedding REAL[],
+    embedding_model VARCHAR(128),
+    UNIQUE (document_id, chunk_index)
+);
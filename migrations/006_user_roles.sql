@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'user';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS banned_at TIMESTAMP;
+-- per-user override of the daily AI token limit, NULL uses the configured default
+ALTER TABLE users ADD COLUMN IF NOT EXISTS daily_tokens BIGINT;
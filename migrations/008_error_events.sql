@@ -0,0 +1,13 @@
+-- panics recovered from update handlers, id is the error id shown to the user
+CREATE TABLE IF NOT EXISTS error_events (
+    id VARCHAR(16) PRIMARY KEY,
+    chat_id BIGINT,
+    user_id BIGINT,
+    update_type VARCHAR(32) NOT NULL,
+    command VARCHAR(64),
+    message TEXT NOT NULL,
+    stack TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_error_events_created_at ON error_events(created_at);
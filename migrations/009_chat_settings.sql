@@ -0,0 +1,9 @@
+-- per-chat preferences changed by group admins with /settings
+CREATE TABLE IF NOT EXISTS chat_settings (
+    chat_id BIGINT PRIMARY KEY,
+    disabled_commands TEXT[] NOT NULL DEFAULT '{}',
+    language VARCHAR(32),
+    persona TEXT,
+    updated_by BIGINT,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
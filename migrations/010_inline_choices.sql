@@ -0,0 +1,11 @@
+-- inline results users picked and sent, kind is the result type: ai, weather or photo
+CREATE TABLE IF NOT EXISTS inline_choices (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    result_id VARCHAR(64) NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    query TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_inline_choices_user_id ON inline_choices(user_id);
@@ -0,0 +1,4 @@
+-- the Telegram message an assistant answer was sent as, so its buttons can find it
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS telegram_message_id BIGINT;
+
+CREATE INDEX IF NOT EXISTS idx_messages_telegram_message ON messages(conversation_id, telegram_message_id);
@@ -0,0 +1,2 @@
+-- Telegram file id of a photo sent with a message, it is downloaded again for follow-up questions
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS image_file_id TEXT;
@@ -0,0 +1,2 @@
+-- users who want answers to their voice messages spoken back, toggled with /voice
+ALTER TABLE users ADD COLUMN IF NOT EXISTS voice_replies BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,2 @@
+-- locations name headings and sheets now, e.g. "sheet 2: Quarterly revenue, rows 52-101"
+ALTER TABLE document_chunks ALTER COLUMN location TYPE VARCHAR(255);
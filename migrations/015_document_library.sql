@@ -0,0 +1,6 @@
+-- documents stay in the uploader's library until deleted with /docs: the extracted text lets a
+-- guide be generated again, file_id lets Telegram serve the original file
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS file_id TEXT;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS content TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_documents_user ON documents(user_id, created_at DESC);
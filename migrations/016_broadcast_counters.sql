@@ -0,0 +1,10 @@
+-- delivery outcomes are counted on the broadcast row as they are recorded, so reading a
+-- broadcast doesn't recount its deliveries
+ALTER TABLE broadcasts ADD COLUMN IF NOT EXISTS sent BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE broadcasts ADD COLUMN IF NOT EXISTS blocked BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE broadcasts ADD COLUMN IF NOT EXISTS failed BIGINT NOT NULL DEFAULT 0;
+
+UPDATE broadcasts b SET
+    sent = (SELECT COUNT(*) FROM broadcast_deliveries d WHERE d.broadcast_id = b.id AND d.status = 'sent'),
+    blocked = (SELECT COUNT(*) FROM broadcast_deliveries d WHERE d.broadcast_id = b.id AND d.status = 'blocked'),
+    failed = (SELECT COUNT(*) FROM broadcast_deliveries d WHERE d.broadcast_id = b.id AND d.status = 'failed');
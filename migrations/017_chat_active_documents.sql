@@ -0,0 +1,9 @@
+-- the document each chat's questions are answered from, kept across restarts; deleting the
+-- document clears it in every chat that had it active
+CREATE TABLE IF NOT EXISTS chat_active_documents (
+    chat_id BIGINT PRIMARY KEY,
+    document_id BIGINT NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_chat_active_documents_document ON chat_active_documents(document_id);
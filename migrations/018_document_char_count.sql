@@ -0,0 +1,2 @@
+-- char_count was stored in bytes, it counts characters like the library limits do
+UPDATE documents SET char_count = char_length(content) WHERE content IS NOT NULL;
@@ -3,7 +3,7 @@ package migrations
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sort"
@@ -32,7 +32,7 @@ func RunMigrations(dbpool *pgxpool.Pool) error {
 		}
 	}
 
-	log.Println("All database migrations completed successfully")
+	slog.Info("database migrations completed")
 	return nil
 }
 
@@ -69,7 +69,7 @@ func applyMigration(ctx context.Context, dbpool *pgxpool.Pool, filePath string)
 		return err
 	}
 	if exists {
-		log.Printf("Migration %s already applied, skipping", version)
+		slog.Debug("migration already applied, skipping", "version", version)
 		return nil
 	}
 
@@ -89,6 +89,6 @@ func applyMigration(ctx context.Context, dbpool *pgxpool.Pool, filePath string)
 		return err
 	}
 
-	log.Printf("Applied migration: %s", version)
+	slog.Info("applied migration", "version", version)
 	return nil
 }